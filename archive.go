@@ -0,0 +1,76 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+)
+
+// RenderToArchive renders into memory and writes the rendered tree to w as a gzip compressed tar archive with
+// paths relative to the target directory, like RenderNoop the target is untouched and post-processing and git are skipped
+func (s *Scaffold) RenderToArchive(w io.Writer, data any, opts ...RenderOption) error {
+	mfs := NewMemoryTargetFS()
+
+	err := s.renderMemory(mfs, data, opts...)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, p := range mfs.paths() {
+		if p == filepath.Clean(s.cfg.TargetDirectory) || !isInDirectory(s.cfg.TargetDirectory, p) {
+			continue
+		}
+
+		err = s.archiveFile(tw, mfs, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+func (s *Scaffold) archiveFile(tw *tar.Writer, mfs *MemoryTargetFS, p string) error {
+	stat, err := mfs.Stat(p)
+	if err != nil {
+		return err
+	}
+
+	hdr, err := tar.FileInfoHeader(stat, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = s.report.relativePath(p)
+
+	if stat.IsDir() {
+		hdr.Name += "/"
+		return tw.WriteHeader(hdr)
+	}
+
+	content, err := mfs.ReadFile(p)
+	if err != nil {
+		return err
+	}
+
+	err = tw.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(content)
+
+	return err
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"fmt"
+	"sort"
+	"text/template/parse"
+)
+
+// recordDataKeys notes the top level data keys referenced by templates when usage reporting is enabled
+func (s *Scaffold) recordDataKeys(templates []*parse.Tree) {
+	if s.dataKeys == nil {
+		return
+	}
+
+	for _, t := range templates {
+		if t != nil {
+			templateDataKeys(t.Root, true, s.dataKeys)
+		}
+	}
+}
+
+// templateDataKeys adds the top level data keys referenced in node to keys, dot indicates if . is the top level data
+func templateDataKeys(node parse.Node, dot bool, keys map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			templateDataKeys(c, dot, keys)
+		}
+
+	case *parse.ActionNode:
+		templateDataKeys(n.Pipe, dot, keys)
+
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			templateDataKeys(c, dot, keys)
+		}
+
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			templateDataKeys(a, dot, keys)
+		}
+
+	case *parse.ChainNode:
+		templateDataKeys(n.Node, dot, keys)
+
+	case *parse.FieldNode:
+		if dot && len(n.Ident) > 0 {
+			keys[n.Ident[0]] = true
+		}
+
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			keys[n.Ident[1]] = true
+		}
+
+	case *parse.IfNode:
+		templateDataKeys(n.Pipe, dot, keys)
+		templateDataKeys(n.List, dot, keys)
+		templateDataKeys(n.ElseList, dot, keys)
+
+	// range and with change . in their bodies but not in their else branches
+	case *parse.RangeNode:
+		templateDataKeys(n.Pipe, dot, keys)
+		templateDataKeys(n.List, false, keys)
+		templateDataKeys(n.ElseList, dot, keys)
+
+	case *parse.WithNode:
+		templateDataKeys(n.Pipe, dot, keys)
+		templateDataKeys(n.List, false, keys)
+		templateDataKeys(n.ElseList, dot, keys)
+
+	case *parse.TemplateNode:
+		templateDataKeys(n.Pipe, dot, keys)
+	}
+}
+
+// dataUsageWarnings compares the top level keys of data with those referenced by templates, keys in provided
+// are other data like _data.yaml contents that may be referenced but are not reported when unused
+func dataUsageWarnings(data any, provided map[string]bool, referenced map[string]bool) []string {
+	dm, ok := data.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	var warnings []string
+
+	for k := range dm {
+		if !referenced[k] {
+			warnings = append(warnings, fmt.Sprintf("data key %q is not used by any template", k))
+		}
+	}
+
+	for k := range referenced {
+		if _, ok := dm[k]; !ok && !provided[k] {
+			warnings = append(warnings, fmt.Sprintf("templates reference missing data key %q", k))
+		}
+	}
+
+	sort.Strings(warnings)
+
+	return warnings
+}
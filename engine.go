@@ -0,0 +1,52 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Engine renders templates, it replaces the built-in text/template engine when using NewWithEngine
+type Engine interface {
+	// Render renders the template tmpl called name using data
+	Render(name string, tmpl []byte, data any) ([]byte, error)
+}
+
+// NewWithEngine creates a new scaffold instance that renders templates using engine, template functions,
+// partials and custom delimiters only apply to the built-in engine
+func NewWithEngine(cfg Config, engine Engine) (*Scaffold, error) {
+	if engine == nil {
+		return nil, fmt.Errorf("template engine is required")
+	}
+
+	s, err := New(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.engine = engine
+
+	return s, nil
+}
+
+// renderWithEngine renders tmpl using the custom engine applying size limits and SkipEmpty
+func (s *Scaffold) renderWithEngine(name string, tmpl []byte, data any) ([]byte, error) {
+	res, err := s.engine.Render(name, tmpl, data)
+	if err != nil {
+		return nil, fmt.Errorf("rendering %s failed: %w", name, err)
+	}
+
+	err = s.checkSize(name, int64(len(res)))
+	if err != nil {
+		return nil, err
+	}
+
+	if s.renderSettings(s.currentFile).skipEmpty && len(bytes.TrimSpace(res)) == 0 {
+		return nil, ErrSkippedEmpty
+	}
+
+	return res, nil
+}
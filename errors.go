@@ -0,0 +1,34 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"errors"
+)
+
+var (
+	// ErrTargetExists indicates the target directory already exist
+	ErrTargetExists = errors.New("target directory exist")
+	// ErrSourceMissing indicates no sources were given
+	ErrSourceMissing = errors.New("no sources provided")
+	// ErrSourceUnavailable indicates the source directory could not be read or resolved
+	ErrSourceUnavailable = errors.New("source unavailable")
+	// ErrPathEscape indicates a file would be read or written outside of its directory
+	ErrPathEscape = errors.New("path escapes its directory")
+	// ErrPostProcessFailed indicates a post-processing command failed
+	ErrPostProcessFailed = errors.New("failed to post process")
+	// ErrTemplateParse indicates a template could not be parsed
+	ErrTemplateParse = errors.New("parsing template failed")
+	// ErrCaseCollision indicates two rendered files differ only by case
+	ErrCaseCollision = errors.New("rendered file names collide")
+	// ErrSkippedEmpty indicates a template rendered to an empty result and SkipEmpty is set
+	ErrSkippedEmpty = errors.New("skipped rendering")
+	// ErrSourceTargetOverlap indicates the target directory is inside the source directory or the other way around
+	ErrSourceTargetOverlap = errors.New("source and target directories overlap")
+	// ErrRequiredData indicates data required by the scaffold manifest was not supplied
+	ErrRequiredData = errors.New("required data missing")
+	// ErrSizeLimitExceeded indicates rendering exceeded Config.MaxFileSize or Config.MaxOutputSize, see SizeLimitError
+	ErrSizeLimitExceeded = errors.New("size limit exceeded")
+)
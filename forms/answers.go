@@ -0,0 +1,71 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"fmt"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/core"
+)
+
+// answersSurveyor answers every question using its default, the defaults come from the supplied answers
+// and are used when no terminal is available
+type answersSurveyor struct{}
+
+func (a *answersSurveyor) AskOne(prompt survey.Prompt, response any, opts ...survey.AskOpt) error {
+	options := &survey.AskOptions{}
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return err
+		}
+	}
+
+	var ans any
+	var message string
+
+	switch p := prompt.(type) {
+	case *survey.Input:
+		ans, message = p.Default, p.Message
+	case *survey.Confirm:
+		ans, message = p.Default, p.Message
+	case *survey.Select:
+		message = p.Message
+		for i, o := range p.Options {
+			if o == p.Default {
+				ans = core.OptionAnswer{Value: o, Index: i}
+			}
+		}
+		if ans == nil {
+			return fmt.Errorf("%w: %s", ErrAnswerUnavailable, message)
+		}
+	case *survey.MultiSelect:
+		message = p.Message
+		selected, _ := p.Default.([]string)
+		res := []core.OptionAnswer{}
+		for i, o := range p.Options {
+			if isOneOf(o, selected...) {
+				res = append(res, core.OptionAnswer{Value: o, Index: i})
+			}
+		}
+		ans = res
+	default:
+		return fmt.Errorf("%w: %s", ErrAnswerUnavailable, prompt)
+	}
+
+	for _, v := range options.Validators {
+		err := v(ans)
+		if err != nil {
+			if selected, ok := ans.([]core.OptionAnswer); ans == "" || ok && len(selected) == 0 {
+				return fmt.Errorf("%w: %s", ErrAnswerUnavailable, message)
+			}
+
+			return fmt.Errorf("invalid answer for %s: %w", message, err)
+		}
+	}
+
+	return setSurveyResponse(ans, response)
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"fmt"
+
+	"github.com/expr-lang/expr"
+)
+
+// computeProperty adds the value of a computed property to parent without prompting
+func (p *processor) computeProperty(prop Property, parent entry) error {
+	val, err := p.computedValue(prop)
+	if err != nil {
+		return fmt.Errorf("could not compute %s: %w", prop.Name, err)
+	}
+
+	_, err = parent.addChild(newObjectEntry(map[string]any{prop.Name: val}))
+
+	return err
+}
+
+// computedValue evaluates the expression or template of prop using the environment and answers so far
+func (p *processor) computedValue(prop Property) (any, error) {
+	env := p.expressionEnv()
+
+	switch {
+	case prop.Expression != "":
+		program, err := expr.Compile(prop.Expression, expr.Env(env))
+		if err != nil {
+			return nil, err
+		}
+
+		return expr.Run(program, env)
+
+	case prop.Template != "":
+		return renderTemplate(prop.Template, env)
+
+	default:
+		return nil, fmt.Errorf("no expression or template")
+	}
+}
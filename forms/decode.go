@@ -0,0 +1,224 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Decode stores form answers in target which must be a non-nil pointer.
+//
+// Struct fields are matched to answers using a `form` tag, falling back to the `json` tag and then to a
+// case-insensitive match of the field name. A tag of "-" skips the field. Numbers are converted between
+// integer and float types when no precision is lost.
+func Decode(result map[string]any, target any) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("decode target must be a non-nil pointer, got %T", target)
+	}
+
+	return decodeValue("", result, rv.Elem())
+}
+
+func decodePath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func decodeValue(path string, val any, target reflect.Value) error {
+	if path == "" && val == nil {
+		return nil
+	}
+
+	if val == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	src := reflect.ValueOf(val)
+
+	mismatch := func() error {
+		if path == "" {
+			return fmt.Errorf("expected %s but got %T", target.Type(), val)
+		}
+		return fmt.Errorf("%s: expected %s but got %T", path, target.Type(), val)
+	}
+
+	switch target.Kind() {
+	case reflect.Pointer:
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		return decodeValue(path, val, target.Elem())
+
+	case reflect.Interface:
+		if !src.Type().AssignableTo(target.Type()) {
+			return mismatch()
+		}
+		target.Set(src)
+
+	case reflect.Struct:
+		m, ok := val.(map[string]any)
+		if !ok {
+			return mismatch()
+		}
+		return decodeStruct(path, m, target)
+
+	case reflect.Map:
+		m, ok := val.(map[string]any)
+		if !ok || target.Type().Key().Kind() != reflect.String {
+			return mismatch()
+		}
+
+		res := reflect.MakeMapWithSize(target.Type(), len(m))
+		for k, v := range m {
+			item := reflect.New(target.Type().Elem()).Elem()
+			err := decodeValue(decodePath(path, k), v, item)
+			if err != nil {
+				return err
+			}
+			res.SetMapIndex(reflect.ValueOf(k).Convert(target.Type().Key()), item)
+		}
+		target.Set(res)
+
+	case reflect.Slice:
+		if src.Kind() != reflect.Slice {
+			return mismatch()
+		}
+
+		res := reflect.MakeSlice(target.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			err := decodeValue(fmt.Sprintf("%s[%d]", path, i), src.Index(i).Interface(), res.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		target.Set(res)
+
+	case reflect.String:
+		if src.Kind() != reflect.String {
+			return mismatch()
+		}
+		target.SetString(src.String())
+
+	case reflect.Bool:
+		if src.Kind() != reflect.Bool {
+			return mismatch()
+		}
+		target.SetBool(src.Bool())
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch {
+		case src.CanInt():
+			i = src.Int()
+		case src.CanUint() && src.Uint() <= math.MaxInt64:
+			i = int64(src.Uint())
+		case src.CanFloat() && src.Float() == math.Trunc(src.Float()) && math.Abs(src.Float()) <= math.MaxInt64:
+			i = int64(src.Float())
+		default:
+			return mismatch()
+		}
+		if target.OverflowInt(i) {
+			return fmt.Errorf("%s: %v overflows %s", path, val, target.Type())
+		}
+		target.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		switch {
+		case src.CanInt() && src.Int() >= 0:
+			u = uint64(src.Int())
+		case src.CanUint():
+			u = src.Uint()
+		case src.CanFloat() && src.Float() >= 0 && src.Float() == math.Trunc(src.Float()) && src.Float() <= math.MaxUint64:
+			u = uint64(src.Float())
+		default:
+			return mismatch()
+		}
+		if target.OverflowUint(u) {
+			return fmt.Errorf("%s: %v overflows %s", path, val, target.Type())
+		}
+		target.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		switch {
+		case src.CanFloat():
+			target.SetFloat(src.Float())
+		case src.CanInt():
+			target.SetFloat(float64(src.Int()))
+		case src.CanUint():
+			target.SetFloat(float64(src.Uint()))
+		default:
+			return mismatch()
+		}
+
+	default:
+		return fmt.Errorf("%s: unsupported target type %s", path, target.Type())
+	}
+
+	return nil
+}
+
+func decodeStruct(path string, m map[string]any, target reflect.Value) error {
+	t := target.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, ok := decodeFieldName(field)
+		if !ok {
+			continue
+		}
+
+		key, found := name, false
+		if _, found = m[name]; !found {
+			for k := range m {
+				if strings.EqualFold(k, name) {
+					key, found = k, true
+					break
+				}
+			}
+		}
+		if !found {
+			continue
+		}
+
+		err := decodeValue(decodePath(path, key), m[key], target.Field(i))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeFieldName(field reflect.StructField) (string, bool) {
+	for _, tag := range []string{"form", "json"} {
+		v, ok := field.Tag.Lookup(tag)
+		if !ok {
+			continue
+		}
+
+		name, _, _ := strings.Cut(v, ",")
+		if name == "-" {
+			return "", false
+		}
+		if name != "" {
+			return name, true
+		}
+	}
+
+	return field.Name, true
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ChangeKind describes how an answer changed between two runs of a form
+type ChangeKind string
+
+const (
+	// AnswerAdded is an answer that was not previously given
+	AnswerAdded ChangeKind = "added"
+	// AnswerRemoved is an answer that was previously given but is now absent
+	AnswerRemoved ChangeKind = "removed"
+	// AnswerChanged is an answer that has a new value
+	AnswerChanged ChangeKind = "changed"
+)
+
+// AnswerChange is a single difference between previous and current answers
+type AnswerChange struct {
+	// Path is the dot separated path to the answer, array entries are shown as [index]
+	Path string `json:"path"`
+	// Kind is the type of change
+	Kind ChangeKind `json:"kind"`
+	// Previous is the earlier value, nil when added
+	Previous any `json:"previous,omitempty"`
+	// Current is the new value, nil when removed
+	Current any `json:"current,omitempty"`
+}
+
+func (c AnswerChange) String() string {
+	switch c.Kind {
+	case AnswerAdded:
+		return fmt.Sprintf("+ %s: %v", c.Path, c.Current)
+	case AnswerRemoved:
+		return fmt.Sprintf("- %s: %v", c.Path, c.Previous)
+	default:
+		return fmt.Sprintf("~ %s: %v => %v", c.Path, c.Previous, c.Current)
+	}
+}
+
+// DiffAnswers compares answers from an earlier run of a form with current ones, changes are sorted by path
+func DiffAnswers(previous map[string]any, current map[string]any) []AnswerChange {
+	var changes []AnswerChange
+
+	diffAnswerValues("", previous, current, &changes)
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes
+}
+
+// SummarizeAnswerChanges renders changes as a human readable list, one change per line
+func SummarizeAnswerChanges(changes []AnswerChange) string {
+	if len(changes) == 0 {
+		return "No answers changed\n"
+	}
+
+	var b strings.Builder
+	for _, c := range changes {
+		fmt.Fprintln(&b, c.String())
+	}
+
+	return b.String()
+}
+
+func diffAnswerValues(path string, previous any, current any, changes *[]AnswerChange) {
+	switch {
+	case previous == nil && current == nil:
+		return
+
+	case previous == nil:
+		*changes = append(*changes, AnswerChange{Path: path, Kind: AnswerAdded, Current: current})
+		return
+
+	case current == nil:
+		*changes = append(*changes, AnswerChange{Path: path, Kind: AnswerRemoved, Previous: previous})
+		return
+	}
+
+	pm, pok := answerMap(previous)
+	cm, cok := answerMap(current)
+	if pok && cok {
+		for k, pv := range pm {
+			diffAnswerValues(joinAnswerPath(path, k), pv, cm[k], changes)
+		}
+		for k, cv := range cm {
+			if _, ok := pm[k]; !ok {
+				diffAnswerValues(joinAnswerPath(path, k), nil, cv, changes)
+			}
+		}
+
+		return
+	}
+
+	pl := reflect.ValueOf(previous)
+	cl := reflect.ValueOf(current)
+	if pl.Kind() == reflect.Slice && cl.Kind() == reflect.Slice {
+		for i := 0; i < pl.Len() || i < cl.Len(); i++ {
+			var pv, cv any
+			if i < pl.Len() {
+				pv = pl.Index(i).Interface()
+			}
+			if i < cl.Len() {
+				cv = cl.Index(i).Interface()
+			}
+
+			diffAnswerValues(fmt.Sprintf("%s[%d]", path, i), pv, cv, changes)
+		}
+
+		return
+	}
+
+	if !answerValuesEqual(previous, current) {
+		*changes = append(*changes, AnswerChange{Path: path, Kind: AnswerChanged, Previous: previous, Current: current})
+	}
+}
+
+// answerMap converts maps with string keys like map[string]string to map[string]any
+func answerMap(v any) (map[string]any, bool) {
+	if m, ok := v.(map[string]any); ok {
+		return m, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+
+	res := make(map[string]any, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		res[iter.Key().String()] = iter.Value().Interface()
+	}
+
+	return res, true
+}
+
+// answerValuesEqual compares answers, numbers are compared by value as answers loaded from JSON are always float64
+func answerValuesEqual(a any, b any) bool {
+	af, aok := answerNumber(a)
+	bf, bok := answerNumber(b)
+	if aok && bok {
+		return af == bf
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func answerNumber(v any) (float64, bool) {
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+func joinAnswerPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// enumOptions are the valid values for prop, combining enum with the entries in enum_file
+func (p *processor) enumOptions(prop Property) ([]string, error) {
+	if prop.EnumFile == "" {
+		return prop.Enum, nil
+	}
+
+	file := prop.EnumFile
+	if !filepath.IsAbs(file) && p.opts != nil && p.opts.baseDir != "" {
+		file = filepath.Join(p.opts.baseDir, file)
+	}
+
+	fb, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read enum file for %s: %w", prop.Name, err)
+	}
+
+	res := append([]string{}, prop.Enum...)
+	scanner := bufio.NewScanner(bytes.NewReader(fb))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		res = append(res, line)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("could not read enum file for %s: %w", prop.Name, err)
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("enum file for %s has no entries", prop.Name)
+	}
+
+	return res, nil
+}
+
+// fuzzyFilter matches options containing the characters of filter in order, ignoring case
+func fuzzyFilter(filter string, value string, _ int) bool {
+	value = strings.ToLower(value)
+
+	for _, r := range strings.ToLower(filter) {
+		if unicode.IsSpace(r) {
+			continue
+		}
+
+		i := strings.IndexRune(value, r)
+		if i < 0 {
+			return false
+		}
+
+		value = value[i+len(string(r)):]
+	}
+
+	return true
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"errors"
+)
+
+var (
+	// ErrAnswerUnavailable indicates a question could not be answered without a terminal
+	ErrAnswerUnavailable = errors.New("no answer available")
+	// ErrFormAborted indicates the form was interrupted or too many invalid answers were given
+	ErrFormAborted = errors.New("form aborted")
+	// ErrPromptTimeout indicates a question was not answered within the prompt timeout
+	ErrPromptTimeout = errors.New("prompt timed out")
+)
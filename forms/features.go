@@ -0,0 +1,97 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+// FeaturesEnabledKey is the key in the answer of a features property holding the list of enabled features
+const FeaturesEnabledKey = "enabled"
+
+// askFeatures asks for a selection of the features listed in the enum, the answer holds a boolean for every
+// feature and the list of enabled features in FeaturesEnabledKey
+func (p *processor) askFeatures(prop Property, parent entry) error {
+	d, err := prop.RenderedDescription(p.env)
+	if err != nil {
+		return err
+	}
+	p.printDescription(d)
+
+	var opts []survey.AskOpt
+	if prop.Required {
+		opts = append(opts, survey.WithValidator(survey.MinItems(1)))
+	}
+
+	features, err := p.enumOptions(prop)
+	if err != nil {
+		return err
+	}
+
+	var ans []string
+	err = p.askOne(&survey.MultiSelect{
+		Message:  prop.Name,
+		Help:     p.help(prop.Help),
+		Options:  features,
+		Default:  p.defaultFeatures(prop, features),
+		PageSize: prop.PageSize,
+		Filter:   fuzzyFilter,
+	}, &ans, opts...)
+	if err != nil {
+		return err
+	}
+
+	_, err = parent.addChild(newObjectEntry(map[string]any{prop.Name: featuresValue(features, ans)}))
+
+	return err
+}
+
+// defaultFeatures are the features enabled in earlier answers, the DefaultValue list or the comma separated default
+func (p *processor) defaultFeatures(prop Property, features []string) []string {
+	var res []string
+
+	prev, _ := p.previousValue(prop)
+	if pm, ok := prev.(map[string]any); ok {
+		for _, f := range features {
+			if enabled, _ := pm[f].(bool); enabled {
+				res = append(res, f)
+			}
+		}
+
+		return res
+	}
+
+	dflt := strings.Split(prop.Default, ",")
+	if prop.DefaultValue != nil {
+		dflt = prop.defaultList()
+	}
+
+	for _, f := range dflt {
+		f = strings.TrimSpace(f)
+		if isOneOf(f, features...) {
+			res = append(res, f)
+		}
+	}
+
+	return res
+}
+
+func featuresValue(features []string, enabled []string) map[string]any {
+	res := map[string]any{}
+	list := []any{}
+
+	for _, f := range features {
+		on := isOneOf(f, enabled...)
+		res[f] = on
+		if on {
+			list = append(list, f)
+		}
+	}
+	res[FeaturesEnabledKey] = list
+
+	return res
+}
@@ -6,14 +6,19 @@ package forms
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
 	"github.com/choria-io/scaffold/internal/sprig"
 	"github.com/choria-io/scaffold/internal/validator"
 	"gopkg.in/yaml.v3"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"text/template"
 )
 
@@ -28,26 +33,60 @@ const (
 	PasswordType  = "password"
 	ObjectType    = "object"
 	ArrayType     = "array"
+	ComputedType  = "computed"
+	FeaturesType  = "features"
+	MapType       = "map"
 )
 
 type Form struct {
 	Name        string     `json:"name" yaml:"name"`
 	Description string     `json:"description" yaml:"description"`
+	Version     int        `json:"version" yaml:"version"`
 	Properties  []Property `json:"properties" yaml:"properties"`
 }
 
 type Property struct {
-	Name                  string     `json:"name" yaml:"name"`
-	Description           string     `json:"description" yaml:"description"`
-	Help                  string     `json:"help" yaml:"help"`
-	IfEmpty               string     `json:"empty" yaml:"empty"`
-	Type                  string     `json:"type" yaml:"type"`
-	ConditionalExpression string     `json:"conditional" yaml:"conditional"`
-	ValidationExpression  string     `json:"validation" yaml:"validation"`
-	Required              bool       `json:"required" yaml:"required"`
-	Default               string     `json:"default" yaml:"default"`
-	Enum                  []string   `json:"enum" yaml:"enum"`
-	Properties            []Property `json:"properties" yaml:"properties"`
+	Name                    string     `json:"name" yaml:"name"`
+	Description             string     `json:"description" yaml:"description"`
+	Help                    string     `json:"help" yaml:"help"`
+	IfEmpty                 string     `json:"empty" yaml:"empty"`
+	Type                    string     `json:"type" yaml:"type"`
+	ConditionalExpression   string     `json:"conditional" yaml:"conditional"`
+	ValidationExpression    string     `json:"validation" yaml:"validation"`
+	Required                bool       `json:"required" yaml:"required"`
+	Default                 string     `json:"default" yaml:"default"`
+	DefaultValue            any        `json:"default_value" yaml:"default_value"`
+	Enum                    []string   `json:"enum" yaml:"enum"`
+	Properties              []Property `json:"properties" yaml:"properties"`
+	Deprecated              string     `json:"deprecated" yaml:"deprecated"`
+	Aliases                 []string   `json:"aliases" yaml:"aliases"`
+	Expression              string     `json:"expression" yaml:"expression"`
+	Template                string     `json:"template" yaml:"template"`
+	Retries                 int        `json:"retries" yaml:"retries"`
+	EnumFile                string     `json:"enum_file" yaml:"enum_file"`
+	PageSize                int        `json:"page_size" yaml:"page_size"`
+	KeyValidationExpression string     `json:"key_validation" yaml:"key_validation"`
+	Sensitive               bool       `json:"sensitive" yaml:"sensitive"`
+}
+
+// defaultList is the default of a list property, the list in DefaultValue or else Default as a list of one entry
+func (p *Property) defaultList() []string {
+	switch d := p.DefaultValue.(type) {
+	case []string:
+		return d
+	case []any:
+		res := make([]string, 0, len(d))
+		for _, v := range d {
+			res = append(res, fmt.Sprint(v))
+		}
+		return res
+	}
+
+	if p.Default == "" {
+		return nil
+	}
+
+	return []string{p.Default}
 }
 
 func (p *Property) RenderedDescription(env map[string]any) (string, error) {
@@ -69,64 +108,127 @@ type processor struct {
 	form Form
 	val  entry
 	env  map[string]any
+	opts *processOptions
+
+	surveyor Surveyor
+	out      io.Writer
+
+	// previous holds answers from an earlier run in the scope of the properties being asked
+	previous map[string]any
+	// warned tracks warnings already shown
+	warned map[string]bool
+	// retries is how many invalid answers are tolerated for the property being asked, 0 for unlimited
+	retries int
+	// stdin is standard input read by the built in surveyors when a prompt timeout is set
+	stdin *deadlineReader
 }
 
 // ProcessReader reads all data from r and ProcessForm() it as YAML
-func ProcessReader(r io.Reader, env map[string]any) (map[string]any, error) {
+func ProcessReader(r io.Reader, env map[string]any, opts ...ProcessOption) (map[string]any, error) {
 	fb, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
 
-	return ProcessBytes(fb, env)
+	return ProcessBytes(fb, env, opts...)
 }
 
 // ProcessFile reads f and ProcessForm() it as YAML
-func ProcessFile(f string, env map[string]any) (map[string]any, error) {
+func ProcessFile(f string, env map[string]any, opts ...ProcessOption) (map[string]any, error) {
 	fb, err := os.ReadFile(f)
 	if err != nil {
 		return nil, err
 	}
 
-	return ProcessBytes(fb, env)
+	// relative enum files are found next to the form unless the caller set a different directory
+	opts = append([]ProcessOption{WithBaseDirectory(filepath.Dir(f))}, opts...)
+
+	return ProcessBytes(fb, env, opts...)
 }
 
 // ProcessBytes treats f as a YAML document and ProcessForm() it
-func ProcessBytes(f []byte, env map[string]any) (map[string]any, error) {
+func ProcessBytes(f []byte, env map[string]any, opts ...ProcessOption) (map[string]any, error) {
+	if newProcessOptions(opts...).templated {
+		form, err := ParseTemplatedForm(f, env)
+		if err != nil {
+			return nil, err
+		}
+
+		return ProcessForm(*form, env, opts...)
+	}
+
 	var form Form
 	err := yaml.Unmarshal(f, &form)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("invalid form: %w", err)
 	}
 
-	return ProcessForm(form, env)
+	return ProcessForm(form, env, opts...)
 }
 
 // ProcessForm processes the form and return a data structure with the answers
-func ProcessForm(f Form, env map[string]any) (map[string]any, error) {
-	if !isTerminal() {
+func ProcessForm(f Form, env map[string]any, opts ...ProcessOption) (map[string]any, error) {
+	popts := newProcessOptions(opts...)
+
+	if popts.previous != nil && popts.previousVersion != nil {
+		migrated, err := MigrateAnswers(f, popts.previous, *popts.previousVersion, popts.migrations...)
+		if err != nil {
+			return nil, err
+		}
+		popts.previous = migrated
+	}
+
+	interactive := isTerminal()
+	if !interactive && !popts.answers && popts.surveyor == nil {
 		return nil, fmt.Errorf("can only process forms on a valid terminal")
 	}
 
-	if len(f.Properties) == 0 {
-		return nil, fmt.Errorf("no properties defined")
+	err := f.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid form: %w", err)
 	}
 
 	proc := &processor{
-		form: f,
-		val:  newObjectEntry(map[string]any{}),
-		env:  env,
+		form:     f,
+		val:      newObjectEntry(map[string]any{}),
+		env:      env,
+		opts:     popts,
+		previous: popts.previous,
+		surveyor: &terminalSurveyor{theme: popts.theme},
+		out:      popts.out,
+	}
+
+	switch {
+	case popts.surveyor != nil:
+		proc.surveyor = popts.surveyor
+	case !interactive:
+		proc.surveyor = &answersSurveyor{}
+	case popts.promptTimeout > 0:
+		proc.stdin = newDeadlineReader(os.Stdin)
+		if popts.accessible || accessibleModeRequested() {
+			proc.surveyor = newStdioPlainSurveyorFrom(proc.stdin, proc.output())
+		} else {
+			proc.surveyor = &terminalSurveyor{theme: popts.theme, in: proc.stdin}
+		}
+	case popts.accessible || accessibleModeRequested():
+		proc.surveyor = newStdioPlainSurveyor(proc.output())
+	}
+
+	if popts.recorder != nil {
+		popts.recorder.surveyor = proc.surveyor
+		proc.surveyor = popts.recorder
 	}
 
 	d, err := renderTemplate(f.Description, env)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(d)
-
-	fmt.Println()
+	proc.printf("%s\n\n", wrapText(d, proc.width(), ""))
 
-	survey.AskOne(&survey.Input{Message: "Press enter to start"}, &struct{}{})
+	err = proc.askOne(&survey.Input{Message: "Press enter to start"}, &struct{}{})
+	if err != nil {
+		return nil, err
+	}
 
 	err = proc.askProperties(f.Properties, proc.val)
 	if err != nil {
@@ -143,6 +245,25 @@ func (p *processor) askArrayType(prop Property, parent entry) error {
 		return err
 	}
 
+	empty := false
+	switch nv := val.(type) {
+	case []string:
+		empty = len(nv) == 0
+	case []map[string]any:
+		empty = len(nv) == 0
+	}
+
+	// empty arrays default to [] unless the property requests an empty object or no value at all
+	if empty {
+		ep := prop
+		if ep.IfEmpty == "" {
+			ep.IfEmpty = ArrayIfEmpty
+		}
+
+		_, err = parent.addChild(newObjectEntry(propertyEmptyVal(ep).(map[string]any)))
+		return err
+	}
+
 	np, err := parent.addChild(newObjectEntry(map[string]any{prop.Name: []any{}}))
 	if err != nil {
 		return err
@@ -169,18 +290,23 @@ func (p *processor) askArrayType(prop Property, parent entry) error {
 	}
 }
 
-func (p *processor) askObjWithProperties(prop Property, parent entry) error {
+func (p *processor) askObjWithProperties(prop Property, siblings []Property, parent entry) error {
 	d, err := prop.RenderedDescription(p.env)
 	if err != nil {
 		return err
 	}
-	fmt.Println()
-	fmt.Println(d)
-	fmt.Println()
+	p.printDescription(d)
+
+	previous, _ := p.previousValue(prop)
+	var previousNames []string
+	if prop.Type == ObjectType {
+		previousNames = p.previousEntryNames(siblings)
+	}
+	var added []string
 
 	for {
 		if !prop.Required && prop.Type == ObjectType {
-			ok, err := askConfirmation(fmt.Sprintf("Add %s entry", prop.Name), false)
+			ok, err := p.askConfirmation(withEntriesSummary(fmt.Sprintf("Add %s entry", prop.Name), added), len(added) < len(previousNames))
 			if err != nil {
 				return err
 			}
@@ -197,9 +323,15 @@ func (p *processor) askObjWithProperties(prop Property, parent entry) error {
 		var ans string
 
 		if prop.Type == ObjectType {
-			err := survey.AskOne(&survey.Input{
+			var deflt string
+			if len(added) < len(previousNames) {
+				deflt = previousNames[len(added)]
+			}
+
+			err := p.askOne(&survey.Input{
 				Message: "Unique name for this entry",
-				Help:    prop.Help,
+				Help:    p.help(prop.Help),
+				Default: deflt,
 			}, &ans, survey.WithValidator(survey.Required))
 			if err != nil {
 				return err
@@ -213,10 +345,19 @@ func (p *processor) askObjWithProperties(prop Property, parent entry) error {
 			return err
 		}
 
-		err = p.askProperties(prop.Properties, val)
+		// named entries are stored alongside their siblings rather than below the property
+		scope := previous
+		if prop.Type == ObjectType {
+			scope = p.previous[ans]
+		}
+
+		err = p.withPrevious(scope, func() error {
+			return p.askProperties(prop.Properties, val)
+		})
 		if err != nil {
 			return err
 		}
+		added = append(added, ans)
 
 		// when type is empty we are not asking for a nested object, just one so we bail
 		if prop.Type == "" {
@@ -285,12 +426,31 @@ func (p *processor) askProperties(props []Property, parent entry) error {
 			continue
 		}
 
+		if prop.Deprecated != "" {
+			p.warnOnce(fmt.Sprintf("%s is deprecated: %s", prop.Name, prop.Deprecated))
+		}
+
+		retries := p.retries
+		p.retries = prop.Retries
+		if p.retries == 0 && p.opts != nil {
+			p.retries = p.opts.retries
+		}
+
 		switch {
+		case prop.Type == ComputedType:
+			err = p.computeProperty(prop, parent)
+
+		case prop.Type == FeaturesType:
+			err = p.askFeatures(prop, parent)
+
+		case prop.Type == MapType:
+			err = p.askMap(prop, parent)
+
 		case prop.Type == ArrayType:
 			err = p.askArrayType(prop, parent)
 
 		case isOneOf(prop.Type, ObjectType, "") && len(prop.Properties) > 0:
-			err = p.askObjWithProperties(prop, parent)
+			err = p.askObjWithProperties(prop, props, parent)
 
 		case prop.Type == BoolType:
 			err = p.askBool(prop, parent)
@@ -305,9 +465,19 @@ func (p *processor) askProperties(props []Property, parent entry) error {
 			err = p.askString(prop, parent)
 		}
 
+		p.retries = retries
+
 		if err != nil {
 			return err
 		}
+
+		// each top level property is a section of the form
+		if parent == p.val && p.opts != nil && p.opts.preview && prop.Type != ComputedType {
+			err = p.showPreview()
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -321,16 +491,23 @@ func (p *processor) askStringEnum(prop Property) (string, error) {
 		opts = append(opts, survey.WithValidator(survey.Required))
 	}
 
-	deflt := prop.Default
-	if prop.Default == "" {
-		deflt = prop.Enum[0]
+	options, err := p.enumOptions(prop)
+	if err != nil {
+		return "", err
 	}
 
-	err := survey.AskOne(&survey.Select{
-		Message: prop.Name,
-		Help:    prop.Help,
-		Default: deflt,
-		Options: prop.Enum,
+	deflt := p.defaultValue(prop)
+	if deflt == "" || !isOneOf(deflt, options...) {
+		deflt = options[0]
+	}
+
+	err = p.askOne(&survey.Select{
+		Message:  prop.Name,
+		Help:     p.help(prop.Help),
+		Default:  deflt,
+		Options:  options,
+		PageSize: prop.PageSize,
+		Filter:   fuzzyFilter,
 	}, &ans, opts...)
 	if err != nil {
 		return "", err
@@ -344,11 +521,9 @@ func (p *processor) askStringValue(prop Property) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	fmt.Println()
-	fmt.Println(d)
-	fmt.Println()
+	p.printDescription(d)
 
-	if len(prop.Enum) > 0 {
+	if len(prop.Enum) > 0 || prop.EnumFile != "" {
 		return p.askStringEnum(prop)
 	}
 
@@ -363,16 +538,18 @@ func (p *processor) askStringValue(prop Property) (string, error) {
 		opts = append(opts, survey.WithValidator(validator.SurveyValidator(prop.ValidationExpression, prop.Required)))
 	}
 
-	if prop.Type == PasswordType {
-		err = survey.AskOne(&survey.Password{
+	_, answering := p.surveyor.(*answersSurveyor)
+
+	if prop.Type == PasswordType && !answering {
+		err = p.askOne(&survey.Password{
 			Message: prop.Name,
-			Help:    prop.Help,
+			Help:    p.help(prop.Help),
 		}, &ans, opts...)
 	} else {
-		err = survey.AskOne(&survey.Input{
+		err = p.askOne(&survey.Input{
 			Message: prop.Name,
-			Help:    prop.Help,
-			Default: prop.Default,
+			Help:    p.help(prop.Help),
+			Default: p.defaultValue(prop),
 		}, &ans, opts...)
 	}
 	if err != nil {
@@ -387,17 +564,19 @@ func (p *processor) askFloatValue(prop Property) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	fmt.Println()
-	fmt.Println(d)
-	fmt.Println()
+	p.printDescription(d)
 
 	var ans string
 
-	err = survey.AskOne(&survey.Input{
-		Message: prop.Name,
-		Help:    prop.Help,
-		Default: prop.Default,
-	}, &ans, survey.WithValidator(validator.SurveyValidator("isFloat(value)", true)))
+	if len(prop.Enum) > 0 || prop.EnumFile != "" {
+		ans, err = p.askStringEnum(prop)
+	} else {
+		err = p.askOne(&survey.Input{
+			Message: prop.Name,
+			Help:    p.help(prop.Help),
+			Default: p.defaultValue(prop),
+		}, &ans, survey.WithValidator(validator.SurveyValidator("isFloat(value)", true)))
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -410,17 +589,19 @@ func (p *processor) askIntValue(prop Property) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	fmt.Println()
-	fmt.Println(d)
-	fmt.Println()
+	p.printDescription(d)
 
 	var ans string
 
-	err = survey.AskOne(&survey.Input{
-		Message: prop.Name,
-		Help:    prop.Help,
-		Default: prop.Default,
-	}, &ans, survey.WithValidator(validator.SurveyValidator("isInt(value)", true)))
+	if len(prop.Enum) > 0 || prop.EnumFile != "" {
+		ans, err = p.askStringEnum(prop)
+	} else {
+		err = p.askOne(&survey.Input{
+			Message: prop.Name,
+			Help:    p.help(prop.Help),
+			Default: p.defaultValue(prop),
+		}, &ans, survey.WithValidator(validator.SurveyValidator("isInt(value)", true)))
+	}
 	if err != nil {
 		return 0, err
 	}
@@ -433,23 +614,21 @@ func (p *processor) askBoolValue(prop Property) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	fmt.Println()
-	fmt.Println(d)
-	fmt.Println()
+	p.printDescription(d)
 
 	var ans bool
 	var dflt bool
 
-	if prop.Default != "" {
-		dflt, err = strconv.ParseBool(prop.Default)
+	if d := p.defaultValue(prop); d != "" {
+		dflt, err = strconv.ParseBool(d)
 		if err != nil {
 			return false, err
 		}
 	}
 
-	err = survey.AskOne(&survey.Confirm{
+	err = p.askOne(&survey.Confirm{
 		Message: prop.Name,
-		Help:    prop.Help,
+		Help:    p.help(prop.Help),
 		Default: dflt,
 	}, &ans)
 	if err != nil {
@@ -460,9 +639,13 @@ func (p *processor) askBoolValue(prop Property) (bool, error) {
 }
 
 func (p *processor) askArrayTypeProperty(prop Property) (any, error) {
+	previous, _ := p.previousValue(prop)
+	previousEntries, _ := previous.([]any)
+
 	switch {
 	case len(prop.Properties) > 0:
 		answer := []map[string]any{}
+		var labels []string
 
 		for {
 			if len(answer) > 0 || !prop.Required {
@@ -471,33 +654,69 @@ func (p *processor) askArrayTypeProperty(prop Property) (any, error) {
 					prompt = fmt.Sprintf("Add first '%s' entry", prop.Name)
 				}
 
-				ok, err := askConfirmation(prompt, false)
+				ok, err := p.askConfirmation(withEntriesSummary(prompt, labels), len(answer) < len(previousEntries))
 				if err != nil {
 					return nil, err
 				}
 				if !ok {
-					if len(answer) > 0 {
-						return answer, nil
-					}
-
-					return []map[string]any{propertyEmptyVal(prop).(map[string]any)}, nil
+					return answer, nil
 				}
 			}
 
+			var scope any
+			if len(answer) < len(previousEntries) {
+				scope = previousEntries[len(answer)]
+			}
+
 			val := newObjectEntry(map[string]any{})
-			err := p.askProperties(prop.Properties, val)
+			err := p.withPrevious(scope, func() error {
+				return p.askProperties(prop.Properties, val)
+			})
 			if err != nil {
 				return nil, err
 			}
 
 			_, cv := val.combinedValue()
 			answer = append(answer, cv.(map[string]any))
+
+			// entries are labeled by their first property, typically a name, unless it holds a secret
+			first := prop.Properties[0]
+			label, ok := cv.(map[string]any)[first.Name]
+			if !ok || label == nil || first.Sensitive || first.Type == PasswordType {
+				label = fmt.Sprintf("#%d", len(answer))
+			}
+			labels = append(labels, fmt.Sprint(label))
 		}
 
 	default:
 		var ans []string
+
+		current := prop.defaultList()
+		if previous != nil {
+			current = nil
+			for _, e := range previousEntries {
+				current = append(current, fmt.Sprint(e))
+			}
+		}
+
+		if len(current) > 0 {
+			ok, err := p.askConfirmation(fmt.Sprintf("Keep '%s' entries %s", prop.Name, strings.Join(current, ", ")), true)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				ans = append(ans, current...)
+			}
+		}
+
+		// further entries have no default so an empty answer ends the list, previous answers are a list so
+		// defaultValue() does not use them either
+		entry := prop
+		entry.Default = ""
+		entry.DefaultValue = nil
+
 		for {
-			val, err := p.askStringValue(prop)
+			val, err := p.askStringValue(entry)
 			if err != nil {
 				return nil, err
 			}
@@ -509,7 +728,7 @@ func (p *processor) askArrayTypeProperty(prop Property) (any, error) {
 			ans = append(ans, val)
 		}
 
-		fmt.Println()
+		p.printf("\n")
 
 		return ans, nil
 	}
@@ -520,13 +739,261 @@ func (p *processor) shouldProcess(prop Property) (bool, error) {
 		return true, nil
 	}
 
+	return validator.Validate(p.expressionEnv(), prop.ConditionalExpression)
+}
+
+// expressionEnv is the environment for conditionals and computed properties, the answers so far are available as input
+func (p *processor) expressionEnv() map[string]any {
 	env := make(map[string]any)
 	for k, v := range p.env {
 		env[k] = v
 	}
 
-	_, env["input"] = p.val.combinedValue()
+	_, input := p.val.combinedValue()
+	env["input"] = inputWithAliases(p.form.Properties, input)
 	env["Input"] = env["input"]
 
-	return validator.Validate(env, prop.ConditionalExpression)
+	return env
+}
+
+// previousValue is the answer given to prop in an earlier run
+func (p *processor) previousValue(prop Property) (any, bool) {
+	if p.previous == nil {
+		return nil, false
+	}
+
+	v, ok := p.previous[prop.Name]
+	if ok {
+		return v, ok
+	}
+
+	for _, alias := range prop.Aliases {
+		v, ok = p.previous[alias]
+		if ok {
+			p.warnOnce(fmt.Sprintf("answer %q is deprecated, use %q instead", alias, prop.Name))
+			return v, ok
+		}
+	}
+
+	return nil, false
+}
+
+// output is where descriptions and messages are written
+func (p *processor) output() io.Writer {
+	if p.out == nil {
+		return os.Stdout
+	}
+
+	return p.out
+}
+
+func (p *processor) printf(format string, a ...any) {
+	fmt.Fprintf(p.output(), format, a...)
+}
+
+// printDescription shows the rendered description of a property surrounded by blank lines
+func (p *processor) printDescription(d string) {
+	p.printf("\n%s\n\n", wrapText(d, p.width(), ""))
+}
+
+// warnOnce shows a warning unless it was already shown
+func (p *processor) warnOnce(msg string) {
+	if p.warned == nil {
+		p.warned = make(map[string]bool)
+	}
+
+	if p.warned[msg] {
+		return
+	}
+	p.warned[msg] = true
+
+	p.printf("WARNING: %s\n", msg)
+}
+
+// inputWithAliases copies answers adding entries for the aliases of props so conditionals using old names keep working
+func inputWithAliases(props []Property, input any) any {
+	answers, ok := input.(map[string]any)
+	if !ok {
+		return input
+	}
+
+	res := make(map[string]any, len(answers))
+	for k, v := range answers {
+		res[k] = v
+	}
+
+	for _, prop := range props {
+		v, ok := res[prop.Name]
+		if !ok {
+			continue
+		}
+
+		if prop.Type == "" && len(prop.Properties) > 0 {
+			v = inputWithAliases(prop.Properties, v)
+			res[prop.Name] = v
+		}
+
+		for _, alias := range prop.Aliases {
+			if _, ok := res[alias]; !ok {
+				res[alias] = v
+			}
+		}
+	}
+
+	return res
+}
+
+// defaultValue is the default for a scalar property, preferring answers from earlier runs
+func (p *processor) defaultValue(prop Property) string {
+	v, ok := p.previousValue(prop)
+	if !ok || v == nil {
+		return prop.Default
+	}
+
+	switch v.(type) {
+	case map[string]any, []any:
+		return prop.Default
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// previousEntryNames are the sorted keys of earlier answers holding objects that are not answers to any of props,
+// these are the names given to entries of object properties
+func (p *processor) previousEntryNames(props []Property) []string {
+	var names []string
+
+	for k, v := range p.previous {
+		if _, ok := v.(map[string]any); !ok {
+			continue
+		}
+
+		known := false
+		for _, prop := range props {
+			if prop.Name == k {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			names = append(names, k)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// withPrevious calls cb with the earlier answers scoped to scope
+func (p *processor) withPrevious(scope any, cb func() error) error {
+	parent := p.previous
+	p.previous, _ = scope.(map[string]any)
+	defer func() { p.previous = parent }()
+
+	return cb()
+}
+
+// askOne asks a question, when a retry limit applies the validators given in opts are run here rather than by
+// the surveyor so that the form can be aborted after too many invalid answers
+func (p *processor) askOne(prompt survey.Prompt, response any, opts ...survey.AskOpt) error {
+	if p.retries <= 0 {
+		return abortError(p.askWithTimeout(prompt, response, opts...))
+	}
+
+	options := &survey.AskOptions{}
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return err
+		}
+	}
+
+	for try := 0; ; try++ {
+		err := p.askWithTimeout(prompt, response)
+		if err != nil {
+			return abortError(err)
+		}
+
+		for _, v := range options.Validators {
+			err = v(responseValue(response))
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			return nil
+		}
+
+		if try >= p.retries {
+			return fmt.Errorf("%w: too many invalid answers: %v", ErrFormAborted, err)
+		}
+
+		p.printf("Invalid answer: %v\n", err)
+	}
+}
+
+// abortError turns interrupts into ErrFormAborted
+func abortError(err error) error {
+	if errors.Is(err, terminal.InterruptErr) {
+		return fmt.Errorf("%w: %v", ErrFormAborted, err)
+	}
+
+	return err
+}
+
+// responseValue is the answer stored in response in the form validators expect
+func responseValue(response any) any {
+	switch r := response.(type) {
+	case *string:
+		return *r
+	case *bool:
+		return *r
+	case *[]string:
+		return *r
+	default:
+		return response
+	}
+}
+
+func (p *processor) askConfirmation(prompt string, dflt bool) (bool, error) {
+	ans := dflt
+
+	err := p.askOne(&survey.Confirm{
+		Message: prompt,
+		Default: dflt,
+	}, &ans)
+
+	return ans, err
+}
+
+// maxSummaryEntries is how many entry names are shown in add-another prompts before eliding the rest
+const maxSummaryEntries = 5
+
+// entriesSummary describes entries added so far like "2 entries: web1, web2", empty when there are none
+func entriesSummary(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("1 entry: %s", names[0])
+	}
+
+	shown := names
+	if len(shown) > maxSummaryEntries {
+		shown = append(shown[:maxSummaryEntries:maxSummaryEntries], "...")
+	}
+
+	return fmt.Sprintf("%d entries: %s", len(names), strings.Join(shown, ", "))
+}
+
+// withEntriesSummary adds the summary of names to an add-another prompt
+func withEntriesSummary(prompt string, names []string) string {
+	summary := entriesSummary(names)
+	if summary == "" {
+		return prompt
+	}
+
+	return fmt.Sprintf("%s (%s)", prompt, summary)
 }
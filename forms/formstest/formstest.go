@@ -0,0 +1,240 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package formstest provides a scripted forms.Surveyor for testing code that processes forms
+package formstest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/core"
+	"github.com/choria-io/scaffold/forms"
+)
+
+// defaultAnswer is the type of Default
+type defaultAnswer struct{}
+
+// Default answers a question using the default value of the prompt
+var Default = defaultAnswer{}
+
+// Surveyor answers questions from a queue of scripted answers, use it with forms.WithSurveyor.
+//
+// Answers are a string for input, password and select prompts, a bool for confirmations, a []string for multi
+// selects or Default to accept the default of the prompt. Validators of the question are applied to the answers
+type Surveyor struct {
+	answers []any
+	// messages are the expected questions for each answer when replaying a recording
+	messages []string
+	asked    []string
+	mu       sync.Mutex
+}
+
+// New creates a Surveyor that answers questions with answers in order
+func New(answers ...any) *Surveyor {
+	return &Surveyor{answers: answers}
+}
+
+// Replay creates a Surveyor that answers questions using a recording made with forms.Recorder, asking
+// questions other than those recorded, or in a different order, fails
+func Replay(recording []forms.RecordedAnswer) *Surveyor {
+	s := &Surveyor{messages: []string{}}
+
+	for _, r := range recording {
+		s.messages = append(s.messages, r.Message)
+
+		switch v := r.Answer.(type) {
+		case nil:
+			s.answers = append(s.answers, Default)
+		case []any:
+			list := []string{}
+			for _, i := range v {
+				list = append(list, fmt.Sprint(i))
+			}
+			s.answers = append(s.answers, list)
+		default:
+			s.answers = append(s.answers, v)
+		}
+	}
+
+	return s
+}
+
+// ReplayFile creates a Surveyor that replays a recording saved using forms.Recorder.WriteFile
+func ReplayFile(file string) (*Surveyor, error) {
+	recording, err := forms.ReadRecording(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return Replay(recording), nil
+}
+
+// Asked are the messages of the questions asked so far
+func (s *Surveyor) Asked() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.asked...)
+}
+
+// Remaining is the number of answers that were not used
+func (s *Surveyor) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.answers)
+}
+
+// AskOne implements forms.Surveyor
+func (s *Surveyor) AskOne(prompt survey.Prompt, response any, opts ...survey.AskOpt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	options := &survey.AskOptions{}
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return err
+		}
+	}
+
+	message := promptMessage(prompt)
+	s.asked = append(s.asked, message)
+
+	if len(s.answers) == 0 {
+		return fmt.Errorf("no answer scripted for %q", message)
+	}
+
+	answer := s.answers[0]
+	s.answers = s.answers[1:]
+
+	if s.messages != nil {
+		expected := s.messages[0]
+		s.messages = s.messages[1:]
+
+		if expected != message {
+			return fmt.Errorf("expected question %q but %q was asked", expected, message)
+		}
+	}
+
+	ans, err := promptAnswer(prompt, answer)
+	if err != nil {
+		return fmt.Errorf("invalid answer for %q: %w", message, err)
+	}
+
+	for _, v := range options.Validators {
+		err = v(ans)
+		if err != nil {
+			return fmt.Errorf("invalid answer for %q: %w", message, err)
+		}
+	}
+
+	// prompts like "Press enter to start" discard their answer
+	if _, ok := response.(*struct{}); ok {
+		return nil
+	}
+
+	return core.WriteAnswer(response, "", ans)
+}
+
+func promptMessage(prompt survey.Prompt) string {
+	switch p := prompt.(type) {
+	case *survey.Input:
+		return p.Message
+	case *survey.Password:
+		return p.Message
+	case *survey.Confirm:
+		return p.Message
+	case *survey.Select:
+		return p.Message
+	case *survey.MultiSelect:
+		return p.Message
+	default:
+		return fmt.Sprintf("%T", prompt)
+	}
+}
+
+// promptAnswer converts answer to the value survey would produce for prompt
+func promptAnswer(prompt survey.Prompt, answer any) (any, error) {
+	_, useDefault := answer.(defaultAnswer)
+
+	switch p := prompt.(type) {
+	case *survey.Input:
+		if useDefault {
+			return p.Default, nil
+		}
+		return stringAnswer(answer)
+
+	case *survey.Password:
+		if useDefault {
+			return "", nil
+		}
+		return stringAnswer(answer)
+
+	case *survey.Confirm:
+		if useDefault {
+			return p.Default, nil
+		}
+		b, ok := answer.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected a bool answer, got %T", answer)
+		}
+		return b, nil
+
+	case *survey.Select:
+		if useDefault {
+			answer = fmt.Sprint(p.Default)
+		}
+		val, err := stringAnswer(answer)
+		if err != nil {
+			return nil, err
+		}
+		for i, o := range p.Options {
+			if o == val {
+				return core.OptionAnswer{Value: o, Index: i}, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not one of the options", val)
+
+	case *survey.MultiSelect:
+		if useDefault {
+			answer, _ = p.Default.([]string)
+			if answer == nil {
+				answer = []string{}
+			}
+		}
+		vals, ok := answer.([]string)
+		if !ok {
+			return nil, fmt.Errorf("expected a []string answer, got %T", answer)
+		}
+		res := []core.OptionAnswer{}
+		for _, val := range vals {
+			found := false
+			for i, o := range p.Options {
+				if o == val {
+					res = append(res, core.OptionAnswer{Value: o, Index: i})
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("%q is not one of the options", val)
+			}
+		}
+		return res, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported prompt %T", prompt)
+	}
+}
+
+func stringAnswer(answer any) (string, error) {
+	s, ok := answer.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string answer, got %T", answer)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package formstest_test
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/choria-io/scaffold/forms"
+	"github.com/choria-io/scaffold/forms/formstest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestFormsTest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Forms Test")
+}
+
+var _ = Describe("Surveyor", func() {
+	form := []byte(`
+name: test
+description: Test form
+properties:
+  - name: name
+    description: Your name
+    type: string
+    required: true
+  - name: region
+    description: Region
+    type: string
+    enum: [eu, us]
+    default: us
+  - name: features
+    description: Features
+    type: features
+    enum: [a, b, c]
+  - name: admin
+    description: Admin
+    type: bool
+`)
+
+	It("Should answer questions in order", func() {
+		s := formstest.New(formstest.Default, "bob", formstest.Default, []string{"a", "c"}, true)
+
+		res, err := forms.ProcessBytes(form, nil, forms.WithSurveyor(s), forms.WithOutput(io.Discard))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(HaveKeyWithValue("name", "bob"))
+		Expect(res).To(HaveKeyWithValue("region", "us"))
+		Expect(res).To(HaveKeyWithValue("admin", true))
+		Expect(res["features"]).To(HaveKeyWithValue("enabled", []any{"a", "c"}))
+		Expect(s.Remaining()).To(Equal(0))
+		Expect(s.Asked()).To(HaveLen(5))
+	})
+
+	It("Should fail for invalid and missing answers", func() {
+		_, err := forms.ProcessBytes(form, nil, forms.WithSurveyor(formstest.New(formstest.Default, "")), forms.WithOutput(io.Discard))
+		Expect(err).To(MatchError(ContainSubstring("invalid answer")))
+
+		_, err = forms.ProcessBytes(form, nil, forms.WithSurveyor(formstest.New(formstest.Default, "bob", "asia")), forms.WithOutput(io.Discard))
+		Expect(err).To(MatchError(ContainSubstring(`"asia" is not one of the options`)))
+
+		_, err = forms.ProcessBytes(form, nil, forms.WithSurveyor(formstest.New(formstest.Default, "bob")), forms.WithOutput(io.Discard))
+		Expect(err).To(MatchError(ContainSubstring("no answer scripted")))
+	})
+
+	It("Should replay recorded sessions", func() {
+		rec := forms.NewRecorder()
+		res, err := forms.ProcessBytes(form, nil, forms.WithSurveyor(formstest.New(formstest.Default, "bob", "eu", []string{"b"}, false)), forms.WithRecorder(rec), forms.WithOutput(io.Discard))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rec.Answers()).To(HaveLen(5))
+		Expect(rec.Answers()[1]).To(Equal(forms.RecordedAnswer{Message: "name", Answer: "bob"}))
+
+		script := filepath.Join(GinkgoT().TempDir(), "session.yaml")
+		Expect(rec.WriteFile(script)).To(Succeed())
+
+		replay, err := formstest.ReplayFile(script)
+		Expect(err).ToNot(HaveOccurred())
+		replayed, err := forms.ProcessBytes(form, nil, forms.WithSurveyor(replay), forms.WithOutput(io.Discard))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replayed).To(Equal(res))
+		Expect(replay.Remaining()).To(Equal(0))
+
+		recording := rec.Answers()
+		recording[1].Message = "other"
+		_, err = forms.ProcessBytes(form, nil, forms.WithSurveyor(formstest.Replay(recording)), forms.WithOutput(io.Discard))
+		Expect(err).To(MatchError(ContainSubstring(`expected question "other" but "name" was asked`)))
+	})
+})
@@ -5,7 +5,18 @@
 package forms
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/core"
+	"github.com/AlecAivazis/survey/v2/terminal"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -58,4 +69,927 @@ var _ = Describe("Forms", func() {
 			Expect(v).To(Equal(expected))
 		})
 	})
+	Describe("Previous answers", func() {
+		It("Should prefer previous scalar answers as defaults", func() {
+			p := &processor{previous: map[string]any{"name": "bob", "port": 4222, "nested": map[string]any{"x": 1}}}
+
+			Expect(p.defaultValue(Property{Name: "name", Default: "jill"})).To(Equal("bob"))
+			Expect(p.defaultValue(Property{Name: "port", Default: "1"})).To(Equal("4222"))
+			Expect(p.defaultValue(Property{Name: "nested", Default: "x"})).To(Equal("x"))
+			Expect(p.defaultValue(Property{Name: "other", Default: "y"})).To(Equal("y"))
+		})
+
+		It("Should scope previous answers", func() {
+			p := &processor{previous: map[string]any{"nested": map[string]any{"name": "bob"}}}
+
+			scope, _ := p.previousValue(Property{Name: "nested"})
+			err := p.withPrevious(scope, func() error {
+				Expect(p.defaultValue(Property{Name: "name"})).To(Equal("bob"))
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.previous).To(HaveKey("nested"))
+		})
+	})
+	Describe("DiffAnswers", func() {
+		It("Should report added, removed and changed answers", func() {
+			previous := map[string]any{
+				"name":    "bob",
+				"port":    4222,
+				"removed": true,
+				"nested":  map[string]any{"x": 1, "urls": []any{"a", "b"}},
+			}
+			current := map[string]any{
+				"name":   "bob",
+				"port":   4223,
+				"added":  "yes",
+				"nested": map[string]any{"x": 1, "urls": []string{"a", "c", "d"}},
+			}
+
+			changes := DiffAnswers(previous, current)
+			Expect(changes).To(Equal([]AnswerChange{
+				{Path: "added", Kind: AnswerAdded, Current: "yes"},
+				{Path: "nested.urls[1]", Kind: AnswerChanged, Previous: "b", Current: "c"},
+				{Path: "nested.urls[2]", Kind: AnswerAdded, Current: "d"},
+				{Path: "port", Kind: AnswerChanged, Previous: 4222, Current: 4223},
+				{Path: "removed", Kind: AnswerRemoved, Previous: true},
+			}))
+
+			Expect(SummarizeAnswerChanges(changes)).To(Equal("+ added: yes\n~ nested.urls[1]: b => c\n+ nested.urls[2]: d\n~ port: 4222 => 4223\n- removed: true\n"))
+			Expect(DiffAnswers(previous, previous)).To(BeEmpty())
+			Expect(SummarizeAnswerChanges(nil)).To(Equal("No answers changed\n"))
+		})
+
+		It("Should compare answers loaded from JSON by value", func() {
+			file := filepath.Join(GinkgoT().TempDir(), "answers.json")
+			Expect(os.WriteFile(file, []byte(`{"port": 4222, "ratio": 0.5, "urls": ["a"], "labels": {"env": "prod"}, "servers": [{"port": 80}]}`), 0600)).To(Succeed())
+
+			jb, err := os.ReadFile(file)
+			Expect(err).ToNot(HaveOccurred())
+			var previous map[string]any
+			Expect(json.Unmarshal(jb, &previous)).To(Succeed())
+
+			current := map[string]any{
+				"port":    4222,
+				"ratio":   float32(0.5),
+				"urls":    []string{"a"},
+				"labels":  map[string]string{"env": "prod"},
+				"servers": []map[string]any{{"port": int64(80)}},
+			}
+			Expect(DiffAnswers(previous, current)).To(BeEmpty())
+
+			current["port"] = 4223
+			Expect(DiffAnswers(previous, current)).To(Equal([]AnswerChange{{Path: "port", Kind: AnswerChanged, Previous: float64(4222), Current: 4223}}))
+		})
+	})
+	Describe("ParseTemplatedForm", func() {
+		It("Should render the form against the environment", func() {
+			form, err := ParseTemplatedForm([]byte(`
+name: test
+properties:
+  - name: region
+    type: string
+    enum:
+{{- range .regions }}
+      - {{ . }}
+{{- end }}
+`), map[string]any{"regions": []string{"eu", "us"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(form.Name).To(Equal("test"))
+			Expect(form.Properties[0].Enum).To(Equal([]string{"eu", "us"}))
+		})
+
+		It("Should strictly validate the result", func() {
+			_, err := ParseTemplatedForm([]byte("name: test\nproperties:\n  - name: x\n    typo: string\n"), nil)
+			Expect(err).To(MatchError(ContainSubstring("field typo not found")))
+
+			_, err = ParseTemplatedForm([]byte("name: test\nproperties:\n  - name: x\n    type: {{ .type }}\n"), map[string]any{"type": "strang"})
+			Expect(err).To(MatchError(`invalid form: x: unknown type "strang"`))
+
+			_, err = ParseTemplatedForm([]byte("name: test\nproperties:\n  - name: x\n    properties:\n      - type: string\n"), nil)
+			Expect(err).To(MatchError("invalid form: property in x has no name"))
+
+			_, err = ParseTemplatedForm([]byte("name: test\n"), nil)
+			Expect(err).To(MatchError("invalid form: no properties defined"))
+
+			_, err = ParseTemplatedForm([]byte("name: {{ .x"), nil)
+			Expect(err).To(MatchError(ContainSubstring("could not render form")))
+		})
+	})
+	Describe("Theme", func() {
+		It("Should customize icons", func() {
+			icons := &survey.IconSet{Question: survey.Icon{Text: "?", Format: "green+hb"}, Error: survey.Icon{Text: "X", Format: "red"}}
+
+			theme := Theme{QuestionPrefix: ">>", QuestionFormat: "blue"}
+			theme.iconSet(icons)
+			Expect(icons.Question).To(Equal(survey.Icon{Text: ">>", Format: "blue"}))
+			Expect(icons.Error).To(Equal(survey.Icon{Text: "X", Format: "red"}))
+
+			MonochromeTheme.iconSet(icons)
+			Expect(icons.Question).To(Equal(survey.Icon{Text: "?", Format: ""}))
+			Expect(icons.Error).To(Equal(survey.Icon{Text: "X", Format: ""}))
+		})
+
+		It("Should remove colors but not cursor movement for monochrome themes", func() {
+			f, err := os.CreateTemp(GinkgoT().TempDir(), "out")
+			Expect(err).ToNot(HaveOccurred())
+			defer f.Close()
+
+			w := &monochromeWriter{file: f}
+			Expect(w.Write([]byte("\x1b[1;92m? \x1b[0mName\x1b[1A"))).To(Equal(21))
+			Expect(os.ReadFile(f.Name())).To(Equal([]byte("? Name\x1b[1A")))
+			Expect(w.Fd()).To(Equal(f.Fd()))
+			Expect(core.DisableColor).To(BeFalse())
+		})
+	})
+	Describe("Accessible mode", func() {
+		It("Should ask questions using plain input", func() {
+			out := bytes.NewBuffer([]byte{})
+			s := newPlainSurveyor(strings.NewReader("\n?\nbob\n3\nus\nmaybe\ny\n"), out)
+
+			var name string
+			Expect(s.AskOne(&survey.Input{Message: "Name", Help: "Your name"}, &name, survey.WithValidator(survey.Required))).To(Succeed())
+			Expect(name).To(Equal("bob"))
+
+			var region string
+			Expect(s.AskOne(&survey.Select{Message: "Region", Options: []string{"eu", "us"}}, &region)).To(Succeed())
+			Expect(region).To(Equal("us"))
+
+			var ok bool
+			Expect(s.AskOne(&survey.Confirm{Message: "Sure"}, &ok)).To(Succeed())
+			Expect(ok).To(BeTrue())
+
+			Expect(out.String()).To(Equal(strings.Join([]string{
+				"Name (? for help): Error: Value is required",
+				"Name (? for help): Your name",
+				"Name (? for help): Region",
+				"  1: eu",
+				"  2: us",
+				"Choose 1-2: Please choose a number between 1 and 2",
+				"Choose 1-2: Sure (y/N): Please answer yes or no",
+				"Sure (y/N): ",
+			}, "\n")))
+		})
+
+		It("Should use defaults", func() {
+			s := newPlainSurveyor(strings.NewReader("\n\n\n"), io.Discard)
+
+			var name string
+			Expect(s.AskOne(&survey.Input{Message: "Name", Default: "jill"}, &name)).To(Succeed())
+			Expect(name).To(Equal("jill"))
+
+			var region string
+			Expect(s.AskOne(&survey.Select{Message: "Region", Options: []string{"eu", "us"}, Default: "us"}, &region)).To(Succeed())
+			Expect(region).To(Equal("us"))
+
+			ok := false
+			Expect(s.AskOne(&survey.Confirm{Message: "Sure", Default: true}, &ok)).To(Succeed())
+			Expect(ok).To(BeTrue())
+		})
+
+		It("Should fail when input is exhausted", func() {
+			s := newPlainSurveyor(strings.NewReader(""), io.Discard)
+
+			var name string
+			Expect(s.AskOne(&survey.Input{Message: "Name"}, &name)).To(MatchError(io.EOF))
+		})
+
+		It("Should process properties", func() {
+			p := &processor{
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: newPlainSurveyor(strings.NewReader("bob\n10\n2\n"), io.Discard),
+			}
+
+			err := p.askProperties([]Property{
+				{Name: "name", Type: StringType, Required: true},
+				{Name: "age", Type: IntType},
+				{Name: "region", Type: StringType, Enum: []string{"eu", "us"}},
+			}, p.val)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, v := p.val.combinedValue()
+			Expect(v).To(Equal(map[string]any{"name": "bob", "age": 10, "region": "us"}))
+		})
+	})
+	Describe("Answers", func() {
+		It("Should resolve questions from answers and defaults", func() {
+			p := &processor{
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: &answersSurveyor{},
+				previous: map[string]any{
+					"name":   "bob",
+					"region": "us",
+					"tags":   []any{"a", "b"},
+					"jill":   map[string]any{"admin": true},
+				},
+			}
+
+			err := p.askProperties([]Property{
+				{Name: "name", Type: StringType, Required: true},
+				{Name: "port", Type: IntType, Default: "4222"},
+				{Name: "region", Type: StringType, Enum: []string{"eu", "us"}},
+				{Name: "size", Type: StringType, Enum: []string{"small", "large"}},
+				{Name: "secret", Type: PasswordType},
+				{Name: "tags", Type: ArrayType},
+				{Name: "users", Type: ObjectType, Properties: []Property{{Name: "admin", Type: BoolType}}},
+			}, p.val)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, v := p.val.combinedValue()
+			Expect(v).To(Equal(map[string]any{
+				"name":   "bob",
+				"port":   4222,
+				"region": "us",
+				"size":   "small",
+				"secret": "",
+				"tags":   []any{"a", "b"},
+				"jill":   map[string]any{"admin": true},
+			}))
+		})
+
+		It("Should fail for unavailable answers", func() {
+			p := &processor{val: newObjectEntry(map[string]any{}), surveyor: &answersSurveyor{}}
+
+			err := p.askProperties([]Property{{Name: "name", Type: StringType, Required: true}}, p.val)
+			Expect(err).To(MatchError(ErrAnswerUnavailable))
+
+			p.previous = map[string]any{"name": "x"}
+			err = p.askProperties([]Property{{Name: "name", Type: StringType, ValidationExpression: "len(value) > 3"}}, p.val)
+			Expect(err).To(MatchError(ContainSubstring("invalid answer for name")))
+		})
+	})
+	Describe("Aliases", func() {
+		It("Should populate renamed properties from aliased answers and conditionals", func() {
+			props := []Property{
+				{Name: "hostname", Type: StringType, Aliases: []string{"host"}, Deprecated: "use fqdn"},
+				{Name: "port", Type: IntType, Default: "80", ConditionalExpression: `input.host == "example.net"`},
+				{Name: "nested", Properties: []Property{{Name: "user", Aliases: []string{"username"}}}},
+				{Name: "shell", Type: StringType, ConditionalExpression: `input.nested.username == "bob"`, Default: "bash"},
+			}
+
+			p := &processor{
+				form:     Form{Properties: props},
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: &answersSurveyor{},
+				previous: map[string]any{"host": "example.net", "nested": map[string]any{"username": "bob"}},
+			}
+
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+
+			_, v := p.val.combinedValue()
+			Expect(v).To(Equal(map[string]any{
+				"hostname": "example.net",
+				"port":     80,
+				"nested":   map[string]any{"user": "bob"},
+				"shell":    "bash",
+			}))
+			Expect(p.warned).To(HaveKey(`answer "host" is deprecated, use "hostname" instead`))
+			Expect(p.warned).To(HaveKey(`hostname is deprecated: use fqdn`))
+		})
+	})
+	Describe("Computed properties", func() {
+		It("Should compute values from the environment and answers", func() {
+			props := []Property{
+				{Name: "name", Type: StringType},
+				{Name: "version", Type: StringType, Default: "1.0.0"},
+				{Name: "image", Type: ComputedType, Template: "{{ .registry }}/{{ .input.name }}:{{ .input.version }}"},
+				{Name: "replicas", Type: ComputedType, Expression: `input.name == "web" ? 3 : 1`},
+			}
+
+			p := &processor{
+				form:     Form{Properties: props},
+				val:      newObjectEntry(map[string]any{}),
+				env:      map[string]any{"registry": "registry.example.net"},
+				surveyor: &answersSurveyor{},
+				previous: map[string]any{"name": "web"},
+			}
+
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+
+			_, v := p.val.combinedValue()
+			Expect(v).To(Equal(map[string]any{
+				"name":     "web",
+				"version":  "1.0.0",
+				"image":    "registry.example.net/web:1.0.0",
+				"replicas": 3,
+			}))
+		})
+
+		It("Should require an expression or template", func() {
+			_, err := ParseTemplatedForm([]byte("name: test\nproperties:\n  - name: x\n    type: computed\n"), nil)
+			Expect(err).To(MatchError("invalid form: x: computed properties require one of expression or template"))
+		})
+	})
+	Describe("Features", func() {
+		props := []Property{
+			{Name: "features", Type: FeaturesType, Enum: []string{"tls", "metrics", "tracing"}, Default: "metrics, tracing"},
+		}
+
+		It("Should emit a list and booleans", func() {
+			p := &processor{
+				form:     Form{Properties: props},
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: newPlainSurveyor(strings.NewReader("4\n3,1\n"), io.Discard),
+			}
+
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+
+			_, v := p.val.combinedValue()
+			Expect(v).To(Equal(map[string]any{
+				"features": map[string]any{"enabled": []any{"tls", "tracing"}, "tls": true, "metrics": false, "tracing": true},
+			}))
+		})
+
+		It("Should default to previous answers or the default", func() {
+			p := &processor{form: Form{Properties: props}, val: newObjectEntry(map[string]any{}), surveyor: &answersSurveyor{}}
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+			_, v := p.val.combinedValue()
+			Expect(v).To(HaveKeyWithValue("features", HaveKeyWithValue("enabled", []any{"metrics", "tracing"})))
+
+			p = &processor{
+				form:     Form{Properties: props},
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: &answersSurveyor{},
+				previous: map[string]any{"features": map[string]any{"tls": true, "metrics": false}},
+			}
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+			_, v = p.val.combinedValue()
+			Expect(v).To(HaveKeyWithValue("features", HaveKeyWithValue("enabled", []any{"tls"})))
+		})
+
+		It("Should validate feature names", func() {
+			_, err := ParseTemplatedForm([]byte("name: test\nproperties:\n  - name: x\n    type: features\n    enum: [enabled]\n"), nil)
+			Expect(err).To(MatchError(`invalid form: x: "enabled" is not a valid feature name`))
+		})
+	})
+	Describe("Retries", func() {
+		It("Should abort after too many invalid answers", func() {
+			out := bytes.NewBuffer([]byte{})
+			props := []Property{{Name: "port", Type: StringType, ValidationExpression: "isInt(value)", Retries: 2}}
+			p := &processor{
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: newPlainSurveyor(strings.NewReader("a\nb\nc\n10\n"), out),
+			}
+
+			err := p.askProperties(props, p.val)
+			Expect(err).To(MatchError(ErrFormAborted))
+			Expect(err).To(MatchError(ContainSubstring("too many invalid answers")))
+		})
+
+		It("Should accept valid answers within the limit", func() {
+			props := []Property{{Name: "port", Type: StringType, ValidationExpression: "isInt(value)"}}
+			p := &processor{
+				val:      newObjectEntry(map[string]any{}),
+				opts:     newProcessOptions(WithRetries(2)),
+				surveyor: newPlainSurveyor(strings.NewReader("a\nb\n10\n"), io.Discard),
+			}
+
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+			_, v := p.val.combinedValue()
+			Expect(v).To(Equal(map[string]any{"port": "10"}))
+			Expect(p.retries).To(Equal(0))
+		})
+
+		It("Should turn interrupts into ErrFormAborted", func() {
+			Expect(abortError(terminal.InterruptErr)).To(MatchError(ErrFormAborted))
+			Expect(abortError(io.EOF)).To(MatchError(io.EOF))
+		})
+	})
+	Describe("Decode", func() {
+		type user struct {
+			Username string `form:"username"`
+			Admin    bool
+		}
+
+		type config struct {
+			Name     string            `json:"name"`
+			Port     uint16            `form:"port"`
+			Ratio    float64           `form:"ratio"`
+			Tags     []string          `form:"tags"`
+			Users    []user            `form:"users"`
+			Labels   map[string]string `form:"labels"`
+			Leaf     *struct{ URL string }
+			Ignored  string `form:"-"`
+			Anything any    `form:"anything"`
+		}
+
+		It("Should decode answers into structs", func() {
+			var cfg config
+			err := Decode(map[string]any{
+				"name":     "test",
+				"port":     4222,
+				"ratio":    1,
+				"tags":     []any{"a", "b"},
+				"users":    []any{map[string]any{"username": "bob", "admin": true}},
+				"labels":   map[string]any{"env": "prod"},
+				"leaf":     map[string]any{"url": "nats://localhost"},
+				"Ignored":  "x",
+				"anything": []any{1},
+			}, &cfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cfg).To(Equal(config{
+				Name:     "test",
+				Port:     4222,
+				Ratio:    1,
+				Tags:     []string{"a", "b"},
+				Users:    []user{{Username: "bob", Admin: true}},
+				Labels:   map[string]string{"env": "prod"},
+				Leaf:     &struct{ URL string }{URL: "nats://localhost"},
+				Anything: []any{1},
+			}))
+		})
+
+		It("Should report mismatches", func() {
+			var cfg config
+			Expect(Decode(map[string]any{"port": "x"}, &cfg)).To(MatchError("port: expected uint16 but got string"))
+			Expect(Decode(map[string]any{"port": 70000}, &cfg)).To(MatchError("port: 70000 overflows uint16"))
+			Expect(Decode(map[string]any{"users": []any{map[string]any{"admin": "yes"}}}, &cfg)).To(MatchError("users[0].admin: expected bool but got string"))
+			Expect(Decode(map[string]any{}, cfg)).To(MatchError(ContainSubstring("non-nil pointer")))
+		})
+	})
+	Describe("MigrateAnswers", func() {
+		migrations := []Migration{
+			{From: 1, Migrate: func(a map[string]any) (map[string]any, error) {
+				a["hostname"] = a["host"]
+				delete(a, "host")
+				return a, nil
+			}},
+			{From: 2, Migrate: func(a map[string]any) (map[string]any, error) {
+				a["port"] = 4222
+				return a, nil
+			}},
+		}
+
+		It("Should upgrade answers in order", func() {
+			res, err := MigrateAnswers(Form{Version: 3}, map[string]any{"host": "example.net"}, 1, migrations...)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(Equal(map[string]any{"hostname": "example.net", "port": 4222}))
+
+			res, err = MigrateAnswers(Form{Version: 3}, map[string]any{"x": 1}, 3, migrations...)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(Equal(map[string]any{"x": 1}))
+		})
+
+		It("Should detect missing and invalid migrations", func() {
+			_, err := MigrateAnswers(Form{Version: 4}, map[string]any{}, 1, migrations...)
+			Expect(err).To(MatchError("no migration from version 3 to 4"))
+
+			_, err = MigrateAnswers(Form{Version: 1}, map[string]any{}, 2, migrations...)
+			Expect(err).To(MatchError("answers version 2 is newer than form version 1"))
+
+			_, err = MigrateAnswers(Form{Version: 2}, map[string]any{}, 1, migrations[0], migrations[0])
+			Expect(err).To(MatchError("duplicate migration from version 1"))
+		})
+	})
+	Describe("Surveyor", func() {
+		It("Should process forms using the injected surveyor and output", func() {
+			out := bytes.NewBuffer([]byte{})
+			in := newPlainSurveyor(strings.NewReader("\nbob\n"), out)
+
+			res, err := ProcessBytes([]byte(`
+name: test
+description: Test form for {{ .org }}
+properties:
+  - name: name
+    description: Your name
+    type: string
+`), map[string]any{"org": "Choria"}, WithSurveyor(in), WithOutput(out))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(Equal(map[string]any{"name": "bob"}))
+			Expect(out.String()).To(Equal("Test form for Choria\n\nPress enter to start: \nYour name\n\nname: "))
+		})
+	})
+	Describe("Large enums", func() {
+		It("Should load enums from files relative to the form", func() {
+			dir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, "regions.txt"), []byte("# regions\neu-west-1\n\nus-east-1\n"), 0644)).To(Succeed())
+
+			props := []Property{{Name: "region", Type: StringType, Enum: []string{"local"}, EnumFile: "regions.txt", PageSize: 20}}
+			p := &processor{
+				val:      newObjectEntry(map[string]any{}),
+				opts:     newProcessOptions(WithBaseDirectory(dir)),
+				surveyor: newPlainSurveyor(strings.NewReader("3\n"), io.Discard),
+				out:      io.Discard,
+			}
+
+			Expect(p.enumOptions(props[0])).To(Equal([]string{"local", "eu-west-1", "us-east-1"}))
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+			_, v := p.val.combinedValue()
+			Expect(v).To(Equal(map[string]any{"region": "us-east-1"}))
+
+			p.opts = newProcessOptions()
+			_, err := p.enumOptions(props[0])
+			Expect(err).To(MatchError(ContainSubstring("could not read enum file for region")))
+		})
+
+		It("Should fuzzy filter options", func() {
+			Expect(fuzzyFilter("euw", "eu-west-1", 0)).To(BeTrue())
+			Expect(fuzzyFilter("EU W1", "eu-west-1", 0)).To(BeTrue())
+			Expect(fuzzyFilter("use", "eu-west-1", 0)).To(BeFalse())
+			Expect(fuzzyFilter("", "anything", 0)).To(BeTrue())
+		})
+	})
+	Describe("Numeric enums", func() {
+		It("Should return numbers", func() {
+			props := []Property{
+				{Name: "port", Type: IntType, Enum: []string{"80", "443"}},
+				{Name: "ratio", Type: FloatType, Enum: []string{"0.5", "1.5"}, Default: "1.5"},
+			}
+			p := &processor{
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: newPlainSurveyor(strings.NewReader("2\n\n"), io.Discard),
+				out:      io.Discard,
+			}
+
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+			_, v := p.val.combinedValue()
+			Expect(v).To(Equal(map[string]any{"port": 443, "ratio": 1.5}))
+		})
+
+		It("Should validate enum values", func() {
+			_, err := ParseTemplatedForm([]byte("name: test\nproperties:\n  - name: port\n    type: integer\n    enum: [80, http]\n"), nil)
+			Expect(err).To(MatchError(`invalid form: port: enum value "http" is not an integer`))
+
+			_, err = ParseTemplatedForm([]byte("name: test\nproperties:\n  - name: ratio\n    type: float\n    enum: [0.5, 1.5]\n"), nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+	Describe("Array defaults", func() {
+		It("Should offer default entries and allow extending them", func() {
+			form, err := ParseTemplatedForm([]byte("name: test\nproperties:\n  - name: tags\n    type: array\n    default_value: [a, b]\n"), nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(form.Properties[0].defaultList()).To(Equal([]string{"a", "b"}))
+
+			p := &processor{
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: newPlainSurveyor(strings.NewReader("\nc\n\n"), io.Discard),
+				out:      io.Discard,
+			}
+			Expect(p.askProperties(form.Properties, p.val)).To(Succeed())
+			_, v := p.val.combinedValue()
+			Expect(v).To(Equal(map[string]any{"tags": []any{"a", "b", "c"}}))
+
+			p = &processor{
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: newPlainSurveyor(strings.NewReader("n\nx\n\n"), io.Discard),
+				out:      io.Discard,
+			}
+			Expect(p.askProperties(form.Properties, p.val)).To(Succeed())
+			_, v = p.val.combinedValue()
+			Expect(v).To(Equal(map[string]any{"tags": []any{"x"}}))
+		})
+
+		It("Should handle scalar defaults", func() {
+			Expect((&Property{DefaultValue: []any{1}}).defaultList()).To(Equal([]string{"1"}))
+			Expect((&Property{Default: "x"}).defaultList()).To(Equal([]string{"x"}))
+			Expect((&Property{}).defaultList()).To(BeNil())
+		})
+
+		It("Should only allow default_value on list and map properties", func() {
+			_, err := ParseTemplatedForm([]byte("name: test\nproperties:\n  - name: port\n    type: integer\n    default_value: [1]\n"), nil)
+			Expect(err).To(MatchError("invalid form: port: default_value is not supported on integer properties"))
+
+			_, err = ParseTemplatedForm([]byte("name: test\nproperties:\n  - name: labels\n    type: map\n    default_value: {a: b}\n"), nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+	Describe("Maps", func() {
+		It("Should ask for unique keys and values", func() {
+			out := bytes.NewBuffer([]byte{})
+			props := []Property{{Name: "labels", Type: MapType, KeyValidationExpression: `value matches "^[a-z]+$"`}}
+			p := &processor{
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: newPlainSurveyor(strings.NewReader("y\nenv\nprod\ny\nenv\nbad key\nBAD\nteam\nops\nn\n"), out),
+				out:      io.Discard,
+			}
+
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+			_, v := p.val.combinedValue()
+			Expect(v).To(Equal(map[string]any{"labels": map[string]any{"env": "prod", "team": "ops"}}))
+			Expect(out.String()).To(ContainSubstring(`Error: duplicate key "env"`))
+			Expect(out.String()).To(ContainSubstring("Error: keys may not contain white space"))
+			Expect(out.String()).To(ContainSubstring("did not pass"))
+		})
+
+		It("Should keep previous entries and support empty values", func() {
+			props := []Property{{Name: "labels", Type: MapType}, {Name: "env", Type: MapType, IfEmpty: ObjectIfEmpty}}
+			p := &processor{
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: &answersSurveyor{},
+				previous: map[string]any{"labels": map[string]any{"env": "prod"}},
+				out:      io.Discard,
+			}
+
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+			_, v := p.val.combinedValue()
+			Expect(v).To(Equal(map[string]any{"labels": map[string]any{"env": "prod"}, "env": map[string]any{}}))
+		})
+	})
+	Describe("Empty values", func() {
+		nested := []Property{{Name: "x", Type: StringType}}
+
+		DescribeTable("Should honor empty for every type",
+			func(prop Property, expected map[string]any) {
+				p := &processor{val: newObjectEntry(map[string]any{}), surveyor: &answersSurveyor{}, out: io.Discard}
+
+				Expect(p.askProperties([]Property{prop, {Name: "other", Type: StringType, Default: "o"}}, p.val)).To(Succeed())
+
+				expected["other"] = "o"
+				_, v := p.val.combinedValue()
+				Expect(v).To(Equal(expected))
+			},
+
+			Entry("string unset", Property{Name: "v", Type: StringType}, map[string]any{"v": ""}),
+			Entry("string absent", Property{Name: "v", Type: StringType, IfEmpty: AbsentIfEmpty}, map[string]any{}),
+			Entry("string array", Property{Name: "v", Type: StringType, IfEmpty: ArrayIfEmpty}, map[string]any{"v": []any{}}),
+			Entry("string object", Property{Name: "v", Type: StringType, IfEmpty: ObjectIfEmpty}, map[string]any{"v": map[string]any{}}),
+
+			Entry("password unset", Property{Name: "v", Type: PasswordType}, map[string]any{"v": ""}),
+			Entry("password absent", Property{Name: "v", Type: PasswordType, IfEmpty: AbsentIfEmpty}, map[string]any{}),
+			Entry("password array", Property{Name: "v", Type: PasswordType, IfEmpty: ArrayIfEmpty}, map[string]any{"v": []any{}}),
+			Entry("password object", Property{Name: "v", Type: PasswordType, IfEmpty: ObjectIfEmpty}, map[string]any{"v": map[string]any{}}),
+
+			Entry("object unset", Property{Name: "v", Type: ObjectType, Properties: nested}, map[string]any{}),
+			Entry("object absent", Property{Name: "v", Type: ObjectType, Properties: nested, IfEmpty: AbsentIfEmpty}, map[string]any{}),
+			Entry("object array", Property{Name: "v", Type: ObjectType, Properties: nested, IfEmpty: ArrayIfEmpty}, map[string]any{"v": []any{}}),
+			Entry("object object", Property{Name: "v", Type: ObjectType, Properties: nested, IfEmpty: ObjectIfEmpty}, map[string]any{"v": map[string]any{}}),
+
+			Entry("string array unset", Property{Name: "v", Type: ArrayType}, map[string]any{"v": []any{}}),
+			Entry("string array absent", Property{Name: "v", Type: ArrayType, IfEmpty: AbsentIfEmpty}, map[string]any{}),
+			Entry("string array array", Property{Name: "v", Type: ArrayType, IfEmpty: ArrayIfEmpty}, map[string]any{"v": []any{}}),
+			Entry("string array object", Property{Name: "v", Type: ArrayType, IfEmpty: ObjectIfEmpty}, map[string]any{"v": map[string]any{}}),
+
+			Entry("object array unset", Property{Name: "v", Type: ArrayType, Properties: nested}, map[string]any{"v": []any{}}),
+			Entry("object array absent", Property{Name: "v", Type: ArrayType, Properties: nested, IfEmpty: AbsentIfEmpty}, map[string]any{}),
+			Entry("object array array", Property{Name: "v", Type: ArrayType, Properties: nested, IfEmpty: ArrayIfEmpty}, map[string]any{"v": []any{}}),
+			Entry("object array object", Property{Name: "v", Type: ArrayType, Properties: nested, IfEmpty: ObjectIfEmpty}, map[string]any{"v": map[string]any{}}),
+
+			Entry("map unset", Property{Name: "v", Type: MapType}, map[string]any{}),
+			Entry("map absent", Property{Name: "v", Type: MapType, IfEmpty: AbsentIfEmpty}, map[string]any{}),
+			Entry("map array", Property{Name: "v", Type: MapType, IfEmpty: ArrayIfEmpty}, map[string]any{"v": []any{}}),
+			Entry("map object", Property{Name: "v", Type: MapType, IfEmpty: ObjectIfEmpty}, map[string]any{"v": map[string]any{}}),
+		)
+	})
+	Describe("Form validation", func() {
+		nested := []Property{{Name: "x"}}
+
+		DescribeTable("Should reject incompatible settings",
+			func(prop Property, expected string) {
+				f := Form{Properties: []Property{prop}}
+				Expect(f.Validate()).To(MatchError(expected))
+			},
+
+			Entry("empty on integer", Property{Name: "v", Type: IntType, IfEmpty: ObjectIfEmpty}, "v: empty is not supported on integer properties"),
+			Entry("empty on nested object", Property{Name: "v", Properties: nested, IfEmpty: AbsentIfEmpty}, "v: empty is not supported on nested objects, they are always asked"),
+			Entry("enum on bool", Property{Name: "v", Type: BoolType, Enum: []string{"true"}}, "v: enum is not supported on bool properties"),
+			Entry("enum on array", Property{Name: "v", Type: ArrayType, EnumFile: "x.txt"}, "v: enum is not supported on array properties"),
+			Entry("page size without enum", Property{Name: "v", PageSize: 10}, "v: page_size requires enum or enum_file"),
+			Entry("properties on string", Property{Name: "v", Type: StringType, Properties: nested}, "v: properties is not supported on string properties"),
+			Entry("object without properties", Property{Name: "v", Type: ObjectType}, "v: object properties require properties"),
+			Entry("template on string", Property{Name: "v", Template: "x"}, "v: expression and template is not supported on string properties"),
+			Entry("key validation on string", Property{Name: "v", KeyValidationExpression: "true"}, "v: key_validation is not supported on string properties"),
+			Entry("validation on integer", Property{Name: "v", Type: IntType, ValidationExpression: "true"}, "v: validation is not supported on integer properties"),
+			Entry("validation on object arrays", Property{Name: "v", Type: ArrayType, Properties: nested, ValidationExpression: "true"}, "v: validation is not supported on arrays of objects"),
+			Entry("nested", Property{Name: "v", Properties: []Property{{Name: "x", Type: BoolType, IfEmpty: ArrayIfEmpty}}}, "v.x: empty is not supported on bool properties"),
+		)
+
+		It("Should accept compatible settings", func() {
+			f := Form{Properties: []Property{
+				{Name: "name", IfEmpty: AbsentIfEmpty, ValidationExpression: "true"},
+				{Name: "port", Type: IntType, Enum: []string{"80"}, PageSize: 5},
+				{Name: "tags", Type: ArrayType, IfEmpty: ArrayIfEmpty, ValidationExpression: "true"},
+				{Name: "labels", Type: MapType, KeyValidationExpression: "true", IfEmpty: ObjectIfEmpty},
+				{Name: "image", Type: ComputedType, Template: "x"},
+			}}
+			Expect(f.Validate()).To(Succeed())
+		})
+
+		It("Should return errors for invalid YAML", func() {
+			_, err := ProcessBytes([]byte("name: [x"), nil)
+			Expect(err).To(MatchError(ContainSubstring("invalid form")))
+		})
+	})
+	Describe("Preview", func() {
+		It("Should show answers after each section with passwords masked", func() {
+			out := bytes.NewBuffer([]byte{})
+
+			_, err := ProcessForm(Form{Properties: []Property{
+				{Name: "name", Type: StringType},
+				{Name: "db", Properties: []Property{{Name: "password", Type: PasswordType}}},
+			}}, nil, WithSurveyor(newPlainSurveyor(strings.NewReader("\nbob\ns3cret\n"), io.Discard)), WithOutput(out), WithPreview())
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(out.String()).To(ContainSubstring("Answers so far:\n\nname: bob\n\n"))
+			Expect(out.String()).To(ContainSubstring("Answers so far:\n\ndb:\n    password: '***'\nname: bob\n"))
+			Expect(out.String()).ToNot(ContainSubstring("s3cret"))
+		})
+
+		It("Should mask passwords in named entries and arrays", func() {
+			props := []Property{
+				{Name: "users", Type: ObjectType, Properties: []Property{{Name: "pass", Type: PasswordType}}},
+				{Name: "list", Type: ArrayType, Properties: []Property{{Name: "pass", Type: PasswordType}}},
+			}
+
+			Expect(maskPasswords(props, map[string]any{
+				"bob":  map[string]any{"pass": "x"},
+				"list": []any{map[string]any{"pass": "y"}},
+			})).To(Equal(map[string]any{
+				"bob":  map[string]any{"pass": RedactedValue},
+				"list": []any{map[string]any{"pass": RedactedValue}},
+			}))
+		})
+	})
+
+	Describe("Sensitive answers", func() {
+		It("Should list sensitive keys and redact changes", func() {
+			f := Form{Properties: []Property{
+				{Name: "name", Type: StringType},
+				{Name: "token", Type: StringType, Sensitive: true},
+				{Name: "db", Properties: []Property{{Name: "password", Type: PasswordType}, {Name: "host", Type: StringType}}},
+			}}
+			Expect(f.SensitiveKeys()).To(Equal([]string{"token", "db.password"}))
+
+			changes := DiffAnswers(
+				map[string]any{"name": "a", "token": "old", "db": map[string]any{"password": "x"}},
+				map[string]any{"name": "b", "token": "new", "db": map[string]any{"password": "y", "host": "h"}},
+			)
+			Expect(SummarizeAnswerChanges(RedactAnswerChanges(changes, f.SensitiveKeys()))).To(Equal("+ db.host: h\n~ db.password: *** => ***\n~ name: a => b\n~ token: *** => ***\n"))
+		})
+
+		It("Should mask sensitive answers in previews", func() {
+			props := []Property{{Name: "token", Type: StringType, Sensitive: true}, {Name: "count", Type: IntType, Sensitive: true}}
+			Expect(maskPasswords(props, map[string]any{"token": "x", "count": 1})).To(Equal(map[string]any{"token": RedactedValue, "count": RedactedValue}))
+		})
+	})
+
+	Describe("Wrapping", func() {
+		DescribeTable("wrapText",
+			func(text string, width int, indent string, expected string) {
+				Expect(wrapText(text, width, indent)).To(Equal(expected))
+			},
+			Entry("disabled", "a long line", 0, "", "a long line"),
+			Entry("short", "a line", 20, "", "a line"),
+			Entry("words", "the quick brown fox jumps", 10, "", "the quick\nbrown fox\njumps"),
+			Entry("indent", "the quick brown fox", 11, "  ", "the quick\n  brown fox"),
+			Entry("long words", "a supercalifragilistic b", 5, "", "a\nsupercalifragilistic\nb"),
+			Entry("paragraphs", "one two\n\nthree", 4, "", "one\ntwo\n\nthree"),
+			Entry("ansi", "\x1b[1mbold\x1b[0m text here", 9, "", "\x1b[1mbold\x1b[0m text\nhere"),
+			Entry("indented", "list:\n  - one two three\n  - x  =  1", 12, "", "list:\n  - one two\n  three\n  - x  =  1"),
+			Entry("white space", "a\n          \nb", 4, "", "a\n\nb"),
+			Entry("indented continuation", "a b\n    code  here", 10, "  ", "a b\n      code\n      here"),
+		)
+
+		It("Should wrap descriptions and help to the configured width", func() {
+			out := bytes.NewBuffer([]byte{})
+			p := &processor{out: out, opts: &processOptions{width: 12}}
+
+			p.printDescription("a description that is long")
+			Expect(out.String()).To(Equal("\na\ndescription\nthat is long\n\n"))
+			Expect(p.help("help text that wraps")).To(Equal("help text\n  that\n  wraps"))
+
+			p.opts.width = -1
+			Expect(p.help("help text that wraps")).To(Equal("help text that wraps"))
+		})
+	})
+
+	Describe("Entry summaries", func() {
+		DescribeTable("entriesSummary",
+			func(names []string, expected string) {
+				Expect(entriesSummary(names)).To(Equal(expected))
+			},
+			Entry("none", nil, ""),
+			Entry("one", []string{"web1"}, "1 entry: web1"),
+			Entry("some", []string{"web1", "web2"}, "2 entries: web1, web2"),
+			Entry("many", []string{"a", "b", "c", "d", "e", "f", "g"}, "7 entries: a, b, c, d, e, ..."),
+		)
+
+		It("Should show entries added so far in add-another prompts", func() {
+			out := bytes.NewBuffer([]byte{})
+			props := []Property{
+				{Name: "servers", Type: ArrayType, Properties: []Property{{Name: "host", Type: StringType}}},
+				{Name: "labels", Type: MapType},
+			}
+			p := &processor{
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: newPlainSurveyor(strings.NewReader("y\nweb1\ny\nweb2\nn\ny\nenv\nprod\nn\n"), out),
+				out:      io.Discard,
+			}
+
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+			Expect(out.String()).To(ContainSubstring("Add additional 'servers' entry (1 entry: web1)"))
+			Expect(out.String()).To(ContainSubstring("Add additional 'servers' entry (2 entries: web1, web2)"))
+			Expect(out.String()).To(ContainSubstring("Add 'labels' entry (1 entry: env)"))
+		})
+
+		It("Should not show secrets in entry summaries", func() {
+			out := bytes.NewBuffer([]byte{})
+			props := []Property{
+				{Name: "tokens", Type: ArrayType, Properties: []Property{{Name: "token", Type: PasswordType}}},
+				{Name: "keys", Type: ArrayType, Properties: []Property{{Name: "key", Type: StringType, Sensitive: true}}},
+			}
+			p := &processor{
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: newPlainSurveyor(strings.NewReader("y\ns3cret\nn\ny\nk3y\nn\n"), out),
+				out:      io.Discard,
+			}
+
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+			Expect(out.String()).To(ContainSubstring("Add additional 'tokens' entry (1 entry: #1)"))
+			Expect(out.String()).To(ContainSubstring("Add additional 'keys' entry (1 entry: #1)"))
+			Expect(out.String()).ToNot(ContainSubstring("s3cret"))
+			Expect(out.String()).ToNot(ContainSubstring("k3y"))
+		})
+	})
+
+	Describe("Prompt timeout", func() {
+		var (
+			pr, pw *os.File
+			stdin  *deadlineReader
+			props  []Property
+		)
+
+		BeforeEach(func() {
+			var err error
+			pr, pw, err = os.Pipe()
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(pr.Close)
+			DeferCleanup(pw.Close)
+
+			stdin = newDeadlineReader(pr)
+			props = []Property{{Name: "name", Type: StringType, Default: "bob"}}
+		})
+
+		newProcessor := func(opts *processOptions) *processor {
+			opts.promptTimeout = 20 * time.Millisecond
+
+			return &processor{
+				val:      newObjectEntry(map[string]any{}),
+				surveyor: newPlainSurveyor(stdin, io.Discard),
+				out:      io.Discard,
+				opts:     opts,
+				stdin:    stdin,
+			}
+		}
+
+		It("Should accept the default when a prompt times out", func() {
+			rec := NewRecorder()
+			p := newProcessor(&processOptions{promptTimeoutDefault: true, recorder: rec})
+
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+			_, res := p.val.combinedValue()
+			Expect(res).To(Equal(map[string]any{"name": "bob"}))
+			Expect(rec.Answers()).To(Equal([]RecordedAnswer{{Message: "name", Answer: "bob"}}))
+		})
+
+		It("Should abort the form when requested", func() {
+			p := newProcessor(&processOptions{})
+
+			Expect(p.askProperties(props, p.val)).To(MatchError(ErrPromptTimeout))
+		})
+
+		It("Should use answers given in time", func() {
+			p := newProcessor(&processOptions{})
+
+			_, err := pw.WriteString("jill\n")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+			_, res := p.val.combinedValue()
+			Expect(res).To(Equal(map[string]any{"name": "jill"}))
+			Expect(stdin.deadline.IsZero()).To(BeTrue())
+		})
+
+		It("Should time out password prompts", func() {
+			props = []Property{{Name: "token", Type: PasswordType}}
+
+			p := newProcessor(&processOptions{})
+			s := p.surveyor.(*plainSurveyor)
+			s.readPassword = s.readHiddenLine
+
+			_, err := pw.WriteString("sec")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.askProperties(props, p.val)).To(MatchError(ErrPromptTimeout))
+
+			_, err = pw.WriteString("ret\r")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.askProperties(props, p.val)).To(Succeed())
+			_, res := p.val.combinedValue()
+			Expect(res).To(Equal(map[string]any{"token": "ret"}))
+		})
+
+		It("Should not consume input once the deadline passed", func() {
+			buf := make([]byte, 10)
+
+			stdin.deadline = time.Now().Add(10 * time.Millisecond)
+			_, err := stdin.Read(buf)
+			Expect(err).To(MatchError(errPromptInterrupted))
+
+			_, err = pw.WriteString("hello")
+			Expect(err).ToNot(HaveOccurred())
+
+			stdin.deadline = time.Time{}
+			n, err := stdin.Read(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(buf[:n])).To(Equal("hello"))
+		})
+	})
 })
@@ -0,0 +1,123 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/choria-io/scaffold/internal/validator"
+)
+
+// askMap asks for key and value pairs, keys are validated using the key validation expression and must be unique
+func (p *processor) askMap(prop Property, parent entry) error {
+	d, err := prop.RenderedDescription(p.env)
+	if err != nil {
+		return err
+	}
+	p.printDescription(d)
+
+	ans := map[string]any{}
+
+	current := p.currentMapEntries(prop)
+	if len(current) > 0 {
+		keys := make([]string, 0, len(current))
+		for k := range current {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var pairs []string
+		for _, k := range keys {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", k, current[k]))
+		}
+
+		ok, err := p.askConfirmation(fmt.Sprintf("Keep '%s' entries %s", prop.Name, strings.Join(pairs, ", ")), true)
+		if err != nil {
+			return err
+		}
+		if ok {
+			for k, v := range current {
+				ans[k] = v
+			}
+		}
+	}
+
+	for {
+		keys := make([]string, 0, len(ans))
+		for k := range ans {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		ok, err := p.askConfirmation(withEntriesSummary(fmt.Sprintf("Add '%s' entry", prop.Name), keys), prop.Required && len(ans) == 0)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if len(ans) == 0 && prop.Required {
+				p.printf("At least one entry is required\n")
+				continue
+			}
+			break
+		}
+
+		var key string
+		keyOpts := []survey.AskOpt{survey.WithValidator(survey.Required), survey.WithValidator(func(v any) error {
+			k, _ := v.(string)
+			if strings.TrimSpace(k) != k || strings.ContainsAny(k, " \t\n") {
+				return fmt.Errorf("keys may not contain white space")
+			}
+			if _, ok := ans[k]; ok {
+				return fmt.Errorf("duplicate key %q", k)
+			}
+			return nil
+		})}
+		if prop.KeyValidationExpression != "" {
+			keyOpts = append(keyOpts, survey.WithValidator(validator.SurveyValidator(prop.KeyValidationExpression, true)))
+		}
+
+		err = p.askOne(&survey.Input{Message: fmt.Sprintf("%s key", prop.Name), Help: p.help(prop.Help)}, &key, keyOpts...)
+		if err != nil {
+			return err
+		}
+
+		var valOpts []survey.AskOpt
+		if prop.ValidationExpression != "" {
+			valOpts = append(valOpts, survey.WithValidator(validator.SurveyValidator(prop.ValidationExpression, false)))
+		}
+
+		var val string
+		err = p.askOne(&survey.Input{Message: fmt.Sprintf("%s value", key), Help: p.help(prop.Help)}, &val, valOpts...)
+		if err != nil {
+			return err
+		}
+
+		ans[key] = val
+	}
+
+	if len(ans) == 0 {
+		_, err = parent.addChild(newObjectEntry(propertyEmptyVal(prop).(map[string]any)))
+		return err
+	}
+
+	_, err = parent.addChild(newObjectEntry(map[string]any{prop.Name: ans}))
+
+	return err
+}
+
+// currentMapEntries are the entries given in an earlier run or the default
+func (p *processor) currentMapEntries(prop Property) map[string]any {
+	if prev, ok := p.previousValue(prop); ok {
+		m, _ := prev.(map[string]any)
+		return m
+	}
+
+	m, _ := prop.DefaultValue.(map[string]any)
+
+	return m
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"fmt"
+)
+
+// Migration upgrades answers saved by version From of a form to the shape of version From+1
+type Migration struct {
+	// From is the form version the migration upgrades from
+	From int
+	// Migrate transforms the answers
+	Migrate func(answers map[string]any) (map[string]any, error)
+}
+
+// MigrateAnswers upgrades answers saved by version of a form to the version of f by applying migrations in order
+func MigrateAnswers(f Form, answers map[string]any, version int, migrations ...Migration) (map[string]any, error) {
+	if version > f.Version {
+		return nil, fmt.Errorf("answers version %d is newer than form version %d", version, f.Version)
+	}
+
+	steps := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		if _, ok := steps[m.From]; ok {
+			return nil, fmt.Errorf("duplicate migration from version %d", m.From)
+		}
+		steps[m.From] = m
+	}
+
+	var err error
+	for v := version; v < f.Version; v++ {
+		m, ok := steps[v]
+		if !ok || m.Migrate == nil {
+			return nil, fmt.Errorf("no migration from version %d to %d", v, v+1)
+		}
+
+		answers, err = m.Migrate(answers)
+		if err != nil {
+			return nil, fmt.Errorf("migrating answers from version %d to %d failed: %w", v, v+1, err)
+		}
+	}
+
+	return answers, nil
+}
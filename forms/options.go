@@ -0,0 +1,148 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"io"
+	"time"
+)
+
+type processOptions struct {
+	previous   map[string]any
+	templated  bool
+	theme      *Theme
+	accessible bool
+	answers    bool
+	retries    int
+
+	previousVersion *int
+	migrations      []Migration
+
+	surveyor Surveyor
+	out      io.Writer
+	baseDir  string
+	preview  bool
+	width    int
+	recorder *Recorder
+
+	promptTimeout        time.Duration
+	promptTimeoutDefault bool
+}
+
+// ProcessOption configures how a form is processed
+type ProcessOption func(*processOptions)
+
+// WithPreviousAnswers uses the answers from an earlier run of the same form as defaults for its questions
+func WithPreviousAnswers(answers map[string]any) ProcessOption {
+	return func(o *processOptions) {
+		o.previous = answers
+	}
+}
+
+// WithAnswers supplies answers to the form, they are used as defaults like WithPreviousAnswers() and allow
+// the form to be processed without a terminal using the answers and defaults
+func WithAnswers(answers map[string]any) ProcessOption {
+	return func(o *processOptions) {
+		o.previous = answers
+		o.answers = true
+	}
+}
+
+// WithTemplatedForm renders form definitions as templates against the environment before parsing them, see ParseTemplatedForm()
+func WithTemplatedForm() ProcessOption {
+	return func(o *processOptions) {
+		o.templated = true
+	}
+}
+
+// WithTheme customizes the look of prompts
+func WithTheme(theme Theme) ProcessOption {
+	return func(o *processOptions) {
+		o.theme = &theme
+	}
+}
+
+// WithAccessibleMode asks questions using plain line input with numbered choices rather than interactive widgets, also enabled by setting ACCESSIBLE=1
+func WithAccessibleMode() ProcessOption {
+	return func(o *processOptions) {
+		o.accessible = true
+	}
+}
+
+// WithRetries sets how many invalid answers are tolerated per question before the form is aborted with ErrFormAborted, properties can override this
+func WithRetries(retries int) ProcessOption {
+	return func(o *processOptions) {
+		o.retries = retries
+	}
+}
+
+// WithAnswersVersion declares the form version that saved the answers given to WithAnswers() or WithPreviousAnswers(),
+// the answers are upgraded to the current form version using migrations before use
+func WithAnswersVersion(version int, migrations ...Migration) ProcessOption {
+	return func(o *processOptions) {
+		o.previousVersion = &version
+		o.migrations = migrations
+	}
+}
+
+// WithSurveyor asks all questions using s, no terminal is required in this case. The formstest package has a scripted Surveyor for tests
+func WithSurveyor(s Surveyor) ProcessOption {
+	return func(o *processOptions) {
+		o.surveyor = s
+	}
+}
+
+// WithOutput writes descriptions and messages to w instead of standard output
+func WithOutput(w io.Writer) ProcessOption {
+	return func(o *processOptions) {
+		o.out = w
+	}
+}
+
+// WithRecorder records the questions asked and answers given by whichever surveyor processes the form
+func WithRecorder(r *Recorder) ProcessOption {
+	return func(o *processOptions) {
+		o.recorder = r
+	}
+}
+
+// WithWidth wraps descriptions and help to width characters rather than the detected terminal width, -1 disables wrapping
+func WithWidth(width int) ProcessOption {
+	return func(o *processOptions) {
+		o.width = width
+	}
+}
+
+// WithPromptTimeout gives up on questions not answered within timeout, the default answer is used when useDefault
+// is true else the form fails with ErrPromptTimeout. Questions asked by a surveyor set using WithSurveyor are not timed
+func WithPromptTimeout(timeout time.Duration, useDefault bool) ProcessOption {
+	return func(o *processOptions) {
+		o.promptTimeout = timeout
+		o.promptTimeoutDefault = useDefault
+	}
+}
+
+// WithBaseDirectory resolves relative enum_file paths against dir, ProcessFile() defaults this to the directory holding the form
+func WithBaseDirectory(dir string) ProcessOption {
+	return func(o *processOptions) {
+		o.baseDir = dir
+	}
+}
+
+// WithPreview shows the data built so far as YAML after every top level property is answered, passwords are masked
+func WithPreview() ProcessOption {
+	return func(o *processOptions) {
+		o.preview = true
+	}
+}
+
+func newProcessOptions(opts ...ProcessOption) *processOptions {
+	popts := &processOptions{}
+	for _, opt := range opts {
+		opt(popts)
+	}
+
+	return popts
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseTemplatedForm renders f as a template against env and strictly parses the result as a form.
+//
+// This allows forms to be customized, for example to inject organization specific enum lists. Templates
+// in descriptions are rendered at this stage so they should not be nested in further template actions.
+func ParseTemplatedForm(f []byte, env map[string]any) (*Form, error) {
+	rendered, err := renderTemplate(string(f), env)
+	if err != nil {
+		return nil, fmt.Errorf("could not render form: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewBufferString(rendered))
+	dec.KnownFields(true)
+
+	var form Form
+	err = dec.Decode(&form)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid form: %w", err)
+	}
+
+	err = form.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid form: %w", err)
+	}
+
+	return &form, nil
+}
+
+// Validate checks the form for unknown types and settings that do not apply to the type of a property
+func (f *Form) Validate() error {
+	return validateProperties("", f.Properties)
+}
+
+func validateProperties(path string, props []Property) error {
+	if len(props) == 0 && path == "" {
+		return fmt.Errorf("no properties defined")
+	}
+
+	for _, prop := range props {
+		name := prop.Name
+		if path != "" {
+			name = path + "." + prop.Name
+		}
+
+		if prop.Name == "" {
+			if path == "" {
+				return fmt.Errorf("property has no name")
+			}
+			return fmt.Errorf("property in %s has no name", path)
+		}
+
+		if prop.Type != "" && !isOneOf(prop.Type, StringType, BoolType, IntType, FloatType, PasswordType, ObjectType, ArrayType, ComputedType, FeaturesType, MapType) {
+			return fmt.Errorf("%s: unknown type %q", name, prop.Type)
+		}
+
+		if prop.Type == ComputedType && (prop.Expression == "") == (prop.Template == "") {
+			return fmt.Errorf("%s: computed properties require one of expression or template", name)
+		}
+
+		if prop.IfEmpty != "" && !isOneOf(prop.IfEmpty, ArrayIfEmpty, ObjectIfEmpty, AbsentIfEmpty) {
+			return fmt.Errorf("%s: unknown empty value %q", name, prop.IfEmpty)
+		}
+
+		err := validatePropertySettings(name, prop)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range prop.Enum {
+			switch prop.Type {
+			case IntType:
+				if _, err := strconv.Atoi(e); err != nil {
+					return fmt.Errorf("%s: enum value %q is not an integer", name, e)
+				}
+			case FloatType:
+				if _, err := strconv.ParseFloat(e, 64); err != nil {
+					return fmt.Errorf("%s: enum value %q is not a number", name, e)
+				}
+			}
+		}
+
+		if len(prop.Enum) > 0 && prop.Default != "" && prop.Type != FeaturesType && !isOneOf(prop.Default, prop.Enum...) {
+			return fmt.Errorf("%s: default %q is not one of the valid values", name, prop.Default)
+		}
+
+		if prop.Type == FeaturesType {
+			if len(prop.Enum) == 0 && prop.EnumFile == "" {
+				return fmt.Errorf("%s: features properties require an enum of feature names", name)
+			}
+			if isOneOf(FeaturesEnabledKey, prop.Enum...) {
+				return fmt.Errorf("%s: %q is not a valid feature name", name, FeaturesEnabledKey)
+			}
+		}
+
+		for _, alias := range prop.Aliases {
+			if alias == "" || alias == prop.Name {
+				return fmt.Errorf("%s: invalid alias %q", name, alias)
+			}
+		}
+
+		err = validateProperties(name, prop.Properties)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validatePropertySettings rejects settings that do not apply to the type of prop
+func validatePropertySettings(name string, prop Property) error {
+	kind := prop.Type
+	if kind == "" {
+		kind = StringType
+		if len(prop.Properties) > 0 {
+			kind = ObjectType
+		}
+	}
+
+	unsupported := func(setting string) error {
+		return fmt.Errorf("%s: %s is not supported on %s properties", name, setting, kind)
+	}
+
+	switch {
+	case prop.IfEmpty != "" && !isOneOf(kind, StringType, PasswordType, ObjectType, ArrayType, MapType):
+		return unsupported("empty")
+	case prop.Type == "" && len(prop.Properties) > 0 && prop.IfEmpty != "":
+		return fmt.Errorf("%s: empty is not supported on nested objects, they are always asked", name)
+	case (len(prop.Enum) > 0 || prop.EnumFile != "") && !isOneOf(kind, StringType, IntType, FloatType, FeaturesType):
+		return unsupported("enum")
+	case prop.PageSize != 0 && len(prop.Enum) == 0 && prop.EnumFile == "":
+		return fmt.Errorf("%s: page_size requires enum or enum_file", name)
+	case len(prop.Properties) > 0 && !isOneOf(kind, ObjectType, ArrayType):
+		return unsupported("properties")
+	case prop.Type == ObjectType && len(prop.Properties) == 0:
+		return fmt.Errorf("%s: object properties require properties", name)
+	case (prop.Expression != "" || prop.Template != "") && kind != ComputedType:
+		return unsupported("expression and template")
+	case prop.DefaultValue != nil && !isOneOf(kind, ArrayType, FeaturesType, MapType):
+		return unsupported("default_value")
+	case prop.KeyValidationExpression != "" && kind != MapType:
+		return unsupported("key_validation")
+	case prop.ValidationExpression != "" && !isOneOf(kind, StringType, PasswordType, ArrayType, MapType):
+		return unsupported("validation")
+	case prop.ValidationExpression != "" && kind == ArrayType && len(prop.Properties) > 0:
+		return fmt.Errorf("%s: validation is not supported on arrays of objects", name)
+	}
+
+	return nil
+}
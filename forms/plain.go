@@ -0,0 +1,297 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/core"
+	surveyterminal "github.com/AlecAivazis/survey/v2/terminal"
+	terminal "golang.org/x/term"
+)
+
+// plainSurveyor asks questions using plain line input without any terminal manipulation, suitable for screen readers and dumb terminals
+type plainSurveyor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// readPassword reads a password without echo, when nil passwords are read as normal lines
+	readPassword func() (string, error)
+}
+
+func newPlainSurveyor(in io.Reader, out io.Writer) *plainSurveyor {
+	return &plainSurveyor{in: bufio.NewReader(in), out: out}
+}
+
+// newStdioPlainSurveyor creates a plainSurveyor reading standard input and writing to out
+func newStdioPlainSurveyor(out io.Writer) *plainSurveyor {
+	return newStdioPlainSurveyorFrom(os.Stdin, out)
+}
+
+// newStdioPlainSurveyorFrom creates a plainSurveyor reading in, which must read standard input, and writing to out
+func newStdioPlainSurveyorFrom(in io.Reader, out io.Writer) *plainSurveyor {
+	s := newPlainSurveyor(in, out)
+
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+		s.readPassword = func() (string, error) {
+			pass, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(s.out)
+			return string(pass), err
+		}
+
+		// terminal.ReadPassword reads standard input directly, bypassing the prompt deadline
+		if _, ok := in.(*deadlineReader); ok {
+			s.readPassword = s.readRawPassword
+		}
+	}
+
+	return s
+}
+
+// readRawPassword reads a password from s.in with standard input in raw mode
+func (s *plainSurveyor) readRawPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer terminal.Restore(fd, state)
+
+	return s.readHiddenLine()
+}
+
+// readHiddenLine reads a line from s.in without echoing it, the terminal has to be in raw mode
+func (s *plainSurveyor) readHiddenLine() (string, error) {
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{s.in, s.out}
+
+	pass, err := terminal.NewTerminal(rw, "").ReadPassword("")
+	if errors.Is(err, io.EOF) {
+		// raw mode delivers interrupts as input which the terminal reports as EOF
+		return "", surveyterminal.InterruptErr
+	}
+
+	return pass, err
+}
+
+// accessibleModeRequested checks the ACCESSIBLE environment variable
+func accessibleModeRequested() bool {
+	ok, _ := strconv.ParseBool(os.Getenv("ACCESSIBLE"))
+	return ok
+}
+
+func (s *plainSurveyor) readLine() (string, error) {
+	line, err := s.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (s *plainSurveyor) AskOne(prompt survey.Prompt, response any, opts ...survey.AskOpt) error {
+	options := &survey.AskOptions{}
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		ans, err := s.ask(prompt)
+		if err != nil {
+			return err
+		}
+
+		valid := true
+		for _, v := range options.Validators {
+			err = v(ans)
+			if err != nil {
+				fmt.Fprintf(s.out, "Error: %v\n", err)
+				valid = false
+				break
+			}
+		}
+
+		if valid {
+			return setSurveyResponse(ans, response)
+		}
+	}
+}
+
+// ask prompts once, returning a string, bool, core.OptionAnswer or []core.OptionAnswer depending on the prompt
+func (s *plainSurveyor) ask(prompt survey.Prompt) (any, error) {
+	switch p := prompt.(type) {
+	case *survey.Input:
+		return s.askInput(p.Message, p.Help, p.Default, nil)
+
+	case *survey.Password:
+		return s.askInput(p.Message, p.Help, "", s.readPassword)
+
+	case *survey.Confirm:
+		dflt := "y/N"
+		if p.Default {
+			dflt = "Y/n"
+		}
+
+		for {
+			ans, err := s.askInput(fmt.Sprintf("%s (%s)", p.Message, dflt), p.Help, "", nil)
+			if err != nil {
+				return nil, err
+			}
+
+			switch strings.ToLower(strings.TrimSpace(ans)) {
+			case "":
+				return p.Default, nil
+			case "y", "yes":
+				return true, nil
+			case "n", "no":
+				return false, nil
+			}
+
+			fmt.Fprintln(s.out, "Please answer yes or no")
+		}
+
+	case *survey.Select:
+		fmt.Fprintf(s.out, "%s\n", p.Message)
+		dflt := ""
+		for i, o := range p.Options {
+			fmt.Fprintf(s.out, "  %d: %s\n", i+1, o)
+			if o == p.Default {
+				dflt = strconv.Itoa(i + 1)
+			}
+		}
+
+		for {
+			ans, err := s.askInput(fmt.Sprintf("Choose 1-%d", len(p.Options)), p.Help, dflt, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			for i, o := range p.Options {
+				if ans == o || ans == strconv.Itoa(i+1) {
+					return core.OptionAnswer{Value: o, Index: i}, nil
+				}
+			}
+
+			fmt.Fprintf(s.out, "Please choose a number between 1 and %d\n", len(p.Options))
+		}
+
+	case *survey.MultiSelect:
+		fmt.Fprintf(s.out, "%s\n", p.Message)
+		var dflt []string
+		selected, _ := p.Default.([]string)
+		for i, o := range p.Options {
+			fmt.Fprintf(s.out, "  %d: %s\n", i+1, o)
+			if isOneOf(o, selected...) {
+				dflt = append(dflt, strconv.Itoa(i+1))
+			}
+		}
+
+	choose:
+		for {
+			ans, err := s.askInput("Choose numbers separated by commas, - for none", p.Help, strings.Join(dflt, ","), nil)
+			if err != nil {
+				return nil, err
+			}
+
+			res := []core.OptionAnswer{}
+			if strings.TrimSpace(ans) == "-" {
+				return res, nil
+			}
+
+			for _, a := range strings.Split(ans, ",") {
+				a = strings.TrimSpace(a)
+				i, err := strconv.Atoi(a)
+				if err != nil || i < 1 || i > len(p.Options) {
+					fmt.Fprintf(s.out, "Please choose numbers between 1 and %d\n", len(p.Options))
+					continue choose
+				}
+
+				res = append(res, core.OptionAnswer{Value: p.Options[i-1], Index: i - 1})
+			}
+
+			return res, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported prompt %T", prompt)
+	}
+}
+
+func (s *plainSurveyor) askInput(message string, help string, dflt string, read func() (string, error)) (string, error) {
+	if read == nil {
+		read = s.readLine
+	}
+
+	for {
+		fmt.Fprint(s.out, message)
+		if help != "" {
+			fmt.Fprint(s.out, " (? for help)")
+		}
+		if dflt != "" {
+			fmt.Fprintf(s.out, " [%s]", dflt)
+		}
+		fmt.Fprint(s.out, ": ")
+
+		ans, err := read()
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case ans == "?" && help != "":
+			fmt.Fprintln(s.out, help)
+		case ans == "":
+			return dflt, nil
+		default:
+			return ans, nil
+		}
+	}
+}
+
+// setSurveyResponse stores a string, bool, core.OptionAnswer or []core.OptionAnswer answer in response
+func setSurveyResponse(ans any, response any) error {
+	switch r := response.(type) {
+	case *string:
+		switch a := ans.(type) {
+		case core.OptionAnswer:
+			*r = a.Value
+		default:
+			*r = fmt.Sprint(a)
+		}
+	case *[]string:
+		opts, ok := ans.([]core.OptionAnswer)
+		if !ok {
+			return fmt.Errorf("cannot store %T answer in a list", ans)
+		}
+		*r = []string{}
+		for _, o := range opts {
+			*r = append(*r, o.Value)
+		}
+	case *bool:
+		b, ok := ans.(bool)
+		if !ok {
+			return fmt.Errorf("cannot store %T answer in a bool", ans)
+		}
+		*r = b
+	case *struct{}:
+	default:
+		return fmt.Errorf("unsupported response type %T", response)
+	}
+
+	return nil
+}
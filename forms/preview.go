@@ -0,0 +1,93 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// showPreview shows the answers given so far as YAML with passwords and sensitive answers masked
+func (p *processor) showPreview() error {
+	_, val := p.val.combinedValue()
+
+	out, err := yaml.Marshal(maskPasswords(p.form.Properties, val))
+	if err != nil {
+		return err
+	}
+
+	p.printf("\nAnswers so far:\n\n%s\n", out)
+
+	return nil
+}
+
+// maskPasswords copies answers replacing the values of password and sensitive properties
+func maskPasswords(props []Property, val any) any {
+	answers, ok := val.(map[string]any)
+	if !ok {
+		return val
+	}
+
+	res := make(map[string]any, len(answers))
+	for k, v := range answers {
+		res[k] = v
+	}
+
+	for _, prop := range props {
+		v, ok := res[prop.Name]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case prop.Sensitive && v != nil && v != "":
+			res[prop.Name] = RedactedValue
+
+		case prop.Type == PasswordType:
+			if s, ok := v.(string); ok && s != "" {
+				res[prop.Name] = RedactedValue
+			}
+
+		case prop.Type == "" && len(prop.Properties) > 0:
+			res[prop.Name] = maskPasswords(prop.Properties, v)
+
+		case prop.Type == ArrayType && len(prop.Properties) > 0:
+			list, ok := v.([]any)
+			if !ok {
+				continue
+			}
+
+			masked := make([]any, len(list))
+			for i, e := range list {
+				masked[i] = maskPasswords(prop.Properties, e)
+			}
+			res[prop.Name] = masked
+		}
+	}
+
+	// named object entries are stored alongside their sibling properties
+	for _, prop := range props {
+		if prop.Type != ObjectType {
+			continue
+		}
+
+		for k, v := range res {
+			if _, ok := v.(map[string]any); ok && !isPropertyName(props, k) {
+				res[k] = maskPasswords(prop.Properties, v)
+			}
+		}
+	}
+
+	return res
+}
+
+func isPropertyName(props []Property, name string) bool {
+	for _, prop := range props {
+		if prop.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/AlecAivazis/survey/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// RecordedAnswer is a question and the answer given to it
+type RecordedAnswer struct {
+	// Message is the question that was asked
+	Message string `json:"message" yaml:"message"`
+	// Answer is a string, bool or list of strings, nil when the answer is not used like for "Press enter to start"
+	Answer any `json:"answer" yaml:"answer"`
+}
+
+// Recorder records every question asked and the answer given while processing a form, use it with WithRecorder.
+// Answers to password prompts are recorded like any other so recordings should be treated as sensitive
+type Recorder struct {
+	surveyor Surveyor
+	answers  []RecordedAnswer
+	mu       sync.Mutex
+}
+
+// NewRecorder creates a new empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Answers are the questions and answers recorded so far
+func (r *Recorder) Answers() []RecordedAnswer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]RecordedAnswer{}, r.answers...)
+}
+
+// WriteFile saves the recording as a YAML script that can be replayed using formstest.Replay
+func (r *Recorder) WriteFile(file string) error {
+	out, err := yaml.Marshal(r.Answers())
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, out, 0600)
+}
+
+// AskOne implements Surveyor by asking the wrapped surveyor and recording the answer
+func (r *Recorder) AskOne(prompt survey.Prompt, response any, opts ...survey.AskOpt) error {
+	if r.surveyor == nil {
+		return fmt.Errorf("recorder is not attached to a form")
+	}
+
+	err := r.surveyor.AskOne(prompt, response, opts...)
+	if err != nil {
+		return err
+	}
+
+	r.record(prompt, response)
+
+	return nil
+}
+
+// record adds the answer stored in response to the recording
+func (r *Recorder) record(prompt survey.Prompt, response any) {
+	rec := RecordedAnswer{Message: promptMessage(prompt)}
+	switch v := response.(type) {
+	case *string:
+		rec.Answer = *v
+	case *[]string:
+		rec.Answer = append([]string{}, *v...)
+	case *bool:
+		rec.Answer = *v
+	}
+
+	r.mu.Lock()
+	r.answers = append(r.answers, rec)
+	r.mu.Unlock()
+}
+
+// ReadRecording reads a recording saved using Recorder.WriteFile
+func ReadRecording(file string) ([]RecordedAnswer, error) {
+	f, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var answers []RecordedAnswer
+	err = yaml.Unmarshal(f, &answers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recording %s: %w", file, err)
+	}
+
+	return answers, nil
+}
+
+// promptMessage is the message shown by a prompt
+func promptMessage(prompt survey.Prompt) string {
+	switch p := prompt.(type) {
+	case *survey.Input:
+		return p.Message
+	case *survey.Password:
+		return p.Message
+	case *survey.Confirm:
+		return p.Message
+	case *survey.Select:
+		return p.Message
+	case *survey.MultiSelect:
+		return p.Message
+	default:
+		return fmt.Sprintf("%T", prompt)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"strings"
+)
+
+// RedactedValue replaces sensitive values
+const RedactedValue = "***"
+
+// SensitiveKeys are the dot separated paths of password and sensitive properties, suitable for
+// scaffold.Config.SensitiveKeys. Properties inside arrays and named objects are not included
+func (f *Form) SensitiveKeys() []string {
+	return sensitiveKeys("", f.Properties)
+}
+
+func sensitiveKeys(path string, props []Property) []string {
+	var res []string
+
+	for _, prop := range props {
+		name := joinAnswerPath(path, prop.Name)
+
+		switch {
+		case prop.Sensitive || prop.Type == PasswordType:
+			res = append(res, name)
+		case prop.Type == "" && len(prop.Properties) > 0:
+			res = append(res, sensitiveKeys(name, prop.Properties)...)
+		}
+	}
+
+	return res
+}
+
+// RedactAnswerChanges replaces the values of changes at or below any of the dot separated keys with RedactedValue
+func RedactAnswerChanges(changes []AnswerChange, keys []string) []AnswerChange {
+	res := make([]AnswerChange, len(changes))
+
+	for i, c := range changes {
+		res[i] = c
+
+		for _, k := range keys {
+			if c.Path != k && !strings.HasPrefix(c.Path, k+".") && !strings.HasPrefix(c.Path, k+"[") {
+				continue
+			}
+
+			if c.Previous != nil {
+				res[i].Previous = RedactedValue
+			}
+			if c.Current != nil {
+				res[i].Current = RedactedValue
+			}
+			break
+		}
+	}
+
+	return res
+}
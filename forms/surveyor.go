@@ -0,0 +1,44 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"os"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
+)
+
+// Surveyor asks questions and stores the answer in response, implementations must support the survey.Input,
+// survey.Password, survey.Confirm, survey.Select and survey.MultiSelect prompts
+type Surveyor interface {
+	AskOne(prompt survey.Prompt, response any, opts ...survey.AskOpt) error
+}
+
+// terminalSurveyor asks questions using interactive survey widgets
+type terminalSurveyor struct {
+	theme *Theme
+	// in replaces standard input when set
+	in terminal.FileReader
+}
+
+func (t *terminalSurveyor) AskOne(prompt survey.Prompt, response any, opts ...survey.AskOpt) error {
+	var in terminal.FileReader = os.Stdin
+	if t.in != nil {
+		in = t.in
+	}
+
+	var out terminal.FileWriter = os.Stdout
+	if t.theme != nil {
+		opts = append(opts, survey.WithIcons(t.theme.iconSet))
+		if t.theme.Monochrome {
+			out = &monochromeWriter{file: os.Stdout}
+		}
+	}
+
+	opts = append(opts, survey.WithStdio(in, out, os.Stderr))
+
+	return survey.AskOne(prompt, response, opts...)
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"os"
+	"regexp"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+// Theme customizes the look of prompts, empty values keep the defaults.
+//
+// Formats are color specifications understood by github.com/mgutz/ansi like "cyan+b"
+type Theme struct {
+	// QuestionPrefix is shown before every question
+	QuestionPrefix string
+	// QuestionFormat is the color of the question prefix
+	QuestionFormat string
+	// HelpIcon is shown before help text
+	HelpIcon string
+	// HelpFormat is the color of the help icon
+	HelpFormat string
+	// ErrorIcon is shown before validation errors
+	ErrorIcon string
+	// ErrorFormat is the color of the error icon
+	ErrorFormat string
+	// SelectIcon marks the focused option in lists
+	SelectIcon string
+	// SelectFormat is the color of the select icon
+	SelectFormat string
+	// Monochrome disables all colors
+	Monochrome bool
+}
+
+// MonochromeTheme is a theme without colors or unicode icons, suitable for screen readers and basic terminals
+var MonochromeTheme = Theme{
+	QuestionPrefix: "?",
+	HelpIcon:       "?",
+	ErrorIcon:      "X",
+	SelectIcon:     ">",
+	Monochrome:     true,
+}
+
+func (t *Theme) iconSet(icons *survey.IconSet) {
+	setIcon := func(icon *survey.Icon, text string, format string) {
+		if text != "" {
+			icon.Text = text
+		}
+		if format != "" {
+			icon.Format = format
+		}
+		if t.Monochrome {
+			icon.Format = ""
+		}
+	}
+
+	setIcon(&icons.Question, t.QuestionPrefix, t.QuestionFormat)
+	setIcon(&icons.Help, t.HelpIcon, t.HelpFormat)
+	setIcon(&icons.HelpInput, t.HelpIcon, t.HelpFormat)
+	setIcon(&icons.Error, t.ErrorIcon, t.ErrorFormat)
+	setIcon(&icons.SelectFocus, t.SelectIcon, t.SelectFormat)
+	setIcon(&icons.MarkedOption, "", t.SelectFormat)
+	setIcon(&icons.UnmarkedOption, "", "")
+}
+
+// colorRe matches ANSI color sequences, cursor movement sequences do not match
+var colorRe = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// monochromeWriter removes colors from prompts written to file, survey only offers the process wide
+// core.DisableColor to disable colors which concurrent forms would race on
+type monochromeWriter struct {
+	file *os.File
+}
+
+func (w *monochromeWriter) Write(p []byte) (int, error) {
+	_, err := w.file.Write(colorRe.ReplaceAll(p, nil))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Fd is the descriptor of the underlying file, survey uses it to find the terminal size and cursor
+func (w *monochromeWriter) Fd() uintptr {
+	return w.file.Fd()
+}
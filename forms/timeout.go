@@ -0,0 +1,89 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+// errPromptInterrupted is returned by deadlineReader reads that did not complete before the deadline
+var errPromptInterrupted = errors.New("prompt interrupted")
+
+// deadlineReader reads a file, reads waiting for input past the deadline give up with errPromptInterrupted
+// without consuming any input so nothing keeps reading once a prompt is abandoned
+type deadlineReader struct {
+	file     *os.File
+	deadline time.Time
+}
+
+func newDeadlineReader(file *os.File) *deadlineReader {
+	return &deadlineReader{file: file}
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if !r.deadline.IsZero() {
+		ready, err := waitReadable(r.file, time.Until(r.deadline))
+		if err != nil {
+			return 0, err
+		}
+		if !ready {
+			return 0, errPromptInterrupted
+		}
+	}
+
+	return r.file.Read(p)
+}
+
+// Fd is the descriptor of the underlying file, survey uses it to manage the terminal mode
+func (r *deadlineReader) Fd() uintptr {
+	return r.file.Fd()
+}
+
+// askWithTimeout asks using the surveyor, when the prompt timeout passes without an answer the default is accepted or ErrPromptTimeout is returned.
+// Only the built in surveyors reading standard input can be timed out
+func (p *processor) askWithTimeout(prompt survey.Prompt, response any, opts ...survey.AskOpt) error {
+	if p.opts == nil || p.opts.promptTimeout <= 0 || p.stdin == nil {
+		return p.surveyor.AskOne(prompt, response, opts...)
+	}
+
+	p.stdin.deadline = time.Now().Add(p.opts.promptTimeout)
+	defer func() { p.stdin.deadline = time.Time{} }()
+
+	err := p.surveyor.AskOne(prompt, response, opts...)
+	if errors.Is(err, errPromptInterrupted) {
+		return p.promptTimedOut(prompt, response, opts...)
+	}
+
+	return err
+}
+
+// promptTimedOut accepts the default answer or aborts the form after a prompt timed out
+func (p *processor) promptTimedOut(prompt survey.Prompt, response any, opts ...survey.AskOpt) error {
+	msg := promptMessage(prompt)
+
+	p.printf("\n")
+
+	if !p.opts.promptTimeoutDefault {
+		return fmt.Errorf("%w: %q after %v", ErrPromptTimeout, msg, p.opts.promptTimeout)
+	}
+
+	err := (&answersSurveyor{}).AskOne(prompt, response, opts...)
+	if err != nil {
+		return fmt.Errorf("%w: %q has no usable default: %v", ErrPromptTimeout, msg, err)
+	}
+
+	p.printf("No answer after %v, using the default for %s\n", p.opts.promptTimeout, msg)
+
+	if p.opts.recorder != nil {
+		p.opts.recorder.record(prompt, response)
+	}
+
+	return nil
+}
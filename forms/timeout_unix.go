@@ -0,0 +1,38 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !windows
+
+package forms
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// waitReadable waits up to timeout for f to have input, reporting false when it has none
+func waitReadable(f *os.File, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return false, nil
+		}
+
+		fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(wait.Milliseconds())+1)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		return n > 0, nil
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build windows
+
+package forms
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// waitReadable waits up to timeout for f to have input, reporting false when it has none
+func waitReadable(f *os.File, timeout time.Duration) (bool, error) {
+	if timeout <= 0 {
+		return false, nil
+	}
+
+	ev, err := windows.WaitForSingleObject(windows.Handle(f.Fd()), uint32(timeout.Milliseconds())+1)
+	switch {
+	case err != nil:
+		return false, err
+	case ev == uint32(windows.WAIT_TIMEOUT):
+		return false, nil
+	}
+
+	return true, nil
+}
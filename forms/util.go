@@ -10,7 +10,6 @@ import (
 	"os"
 	"text/template"
 
-	"github.com/AlecAivazis/survey/v2"
 	terminal "golang.org/x/term"
 )
 
@@ -24,17 +23,6 @@ func propertyEmptyVal(p Property) any {
 		return map[string]any{}
 	}
 }
-func askConfirmation(prompt string, dflt bool) (bool, error) {
-	ans := dflt
-
-	err := survey.AskOne(&survey.Confirm{
-		Message: prompt,
-		Default: dflt,
-	}, &ans)
-
-	return ans, err
-}
-
 func isTerminal() bool {
 	return terminal.IsTerminal(int(os.Stdin.Fd())) && terminal.IsTerminal(int(os.Stdout.Fd()))
 }
@@ -0,0 +1,99 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package forms
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	terminal "golang.org/x/term"
+)
+
+// ansiRe matches ANSI escape sequences which take no space on the terminal
+var ansiRe = regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
+
+// visibleLength is the number of characters s occupies on the terminal
+func visibleLength(s string) int {
+	return utf8.RuneCountInString(ansiRe.ReplaceAllString(s, ""))
+}
+
+// wrapText wraps s at word boundaries so lines are at most width characters, continuation lines are prefixed
+// with indent. Existing line breaks are kept, lines that fit are left untouched and lines that are wrapped keep
+// their leading white space on every part. Words longer than width are not split and width 0 disables wrapping
+func wrapText(s string, width int, indent string) string {
+	if width <= 0 {
+		return s
+	}
+
+	indentLength := visibleLength(indent)
+
+	var lines []string
+	for i, line := range strings.Split(s, "\n") {
+		// every line but the very first is indented when joined
+		available := width
+		if i > 0 {
+			available -= indentLength
+		}
+
+		if visibleLength(line) <= available {
+			lines = append(lines, line)
+			continue
+		}
+
+		lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+
+		current := lead + words[0]
+		length := visibleLength(current)
+		if i > 0 {
+			length += indentLength
+		}
+
+		for _, word := range words[1:] {
+			wl := visibleLength(word)
+			if length+1+wl > width {
+				lines = append(lines, current)
+				current = lead + word
+				length = indentLength + visibleLength(lead) + wl
+				continue
+			}
+
+			current += " " + word
+			length += 1 + wl
+		}
+		lines = append(lines, current)
+	}
+
+	return strings.Join(lines, "\n"+indent)
+}
+
+// width is the width descriptions are wrapped to, set using WithWidth or detected from the terminal when writing to standard output
+func (p *processor) width() int {
+	if p.opts != nil && p.opts.width != 0 {
+		return p.opts.width
+	}
+
+	if p.out != nil || !terminal.IsTerminal(int(os.Stdout.Fd())) {
+		return 0
+	}
+
+	w, _, err := terminal.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+
+	return w
+}
+
+// help wraps help text to the terminal width allowing for the help icon survey shows before it
+func (p *processor) help(h string) string {
+	return wrapText(h, p.width()-2, "  ")
+}
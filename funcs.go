@@ -0,0 +1,68 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// TemplateFunction describes a function available to templates
+type TemplateFunction struct {
+	// Name is the name used to call the function in templates
+	Name string `json:"name"`
+	// Signature is the Go signature of the function without the func keyword
+	Signature string `json:"signature"`
+	// Description is a short description of the function, only set for scaffold built-in functions
+	Description string `json:"description,omitempty"`
+	// Source is where the function comes from, one of builtin, sprig or custom
+	Source string `json:"source"`
+}
+
+// builtinFunctions describes the functions added by scaffold itself
+var builtinFunctions = map[string]string{
+	"write":         "Writes content to a file relative to the target directory",
+	"addPost":       "Adds a post-processing command for files matching a glob, an empty glob runs once in the target",
+	"mkdir":         "Creates a directory and its parents relative to the target directory",
+	"readTarget":    "Reads a file relative to the target directory",
+	"render":        "Renders a template relative to the source directory, typically a partial",
+	"leftDelim":     "Returns a literal {{, for example {{ leftDelim }} .Values.image {{ rightDelim }}",
+	"rightDelim":    "Returns a literal }}",
+	"goIdent":       "Sanitizes a string into a valid Go identifier",
+	"goModulePath":  "Sanitizes a string into a lower case Go module path",
+	"goVersion":     "Returns the Go version scaffold was built with like 1.22.5",
+	"gitRemote":     "Returns the URL of a git remote, origin by default, for the repository holding the target",
+	"gitBranch":     "Returns the current branch of the repository holding the target",
+	"gitLastTag":    "Returns the most recent tag reachable from HEAD in the repository holding the target",
+	"licenseHeader": "Returns a SPDX license header commented for the type of the file being rendered",
+}
+
+// TemplateFunctions lists every function available to templates sorted by name, functions passed to New replace
+// those of the same name from sprig
+func (s *Scaffold) TemplateFunctions() []TemplateFunction {
+	var res []TemplateFunction
+
+	for name, fn := range s.templateFuncs() {
+		f := TemplateFunction{
+			Name:      name,
+			Signature: strings.TrimPrefix(reflect.TypeOf(fn).String(), "func"),
+			Source:    "sprig",
+		}
+
+		if desc, ok := builtinFunctions[name]; ok {
+			f.Source = "builtin"
+			f.Description = desc
+		} else if _, ok := s.funcs[name]; ok {
+			f.Source = "custom"
+		}
+
+		res = append(res, f)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+	return res
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+)
+
+// GitOutput commits the rendered files into a new branch of the git repository holding the target directory, the
+// working tree, index and checked out branch of the repository are not changed
+type GitOutput struct {
+	// Branch is the new branch to create for the rendered files
+	Branch string `yaml:"branch"`
+	// Message is the commit message, rendered as a template using the render data
+	Message string `yaml:"message"`
+	// Remote will receive a push of the branch after committing when set
+	Remote string `yaml:"remote"`
+	// PullRequestCommand is run in the repository after pushing to open a pull request, like gh pr create or glab mr create,
+	// the branch, remote and commit message are in the SCAFFOLD_GIT_BRANCH, SCAFFOLD_GIT_REMOTE and SCAFFOLD_GIT_MESSAGE environment variables
+	PullRequestCommand string `yaml:"pull_request_command"`
+}
+
+// GitInit initializes a new git repository in the target directory holding the rendered files
+type GitInit struct {
+	// Branch is the name of the initial branch, uses the git default when empty
+	Branch string `yaml:"branch"`
+	// Message is the initial commit message, rendered as a template using the render data
+	Message string `yaml:"message"`
+	// RemoteURL is added as a remote when set
+	RemoteURL string `yaml:"remote_url"`
+	// RemoteName is the name of the remote, defaults to origin
+	RemoteName string `yaml:"remote_name"`
+}
+
+func git(dir string, args ...string) (string, error) {
+	return gitWithEnv(dir, nil, args...)
+}
+
+// gitWithEnv runs git with env added to the environment
+func gitWithEnv(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// gitRepositoryRoot finds the repository holding target, the target does not exist before rendering so its nearest existing parent is used
+func gitRepositoryRoot(target string) (string, error) {
+	return git(nearestDirectory(target), "rev-parse", "--show-toplevel")
+}
+
+// validate checks that target is in a git repository that does not already have the branch
+func (o *GitOutput) validate(target string) error {
+	if o.Branch == "" {
+		return fmt.Errorf("git output requires a branch")
+	}
+
+	if o.PullRequestCommand != "" && o.Remote == "" {
+		return fmt.Errorf("git pull requests require a remote")
+	}
+
+	root, err := gitRepositoryRoot(target)
+	if err != nil {
+		return fmt.Errorf("git output requires the target to be in a git repository: %w", err)
+	}
+
+	_, err = git(root, "check-ref-format", "--branch", o.Branch)
+	if err != nil {
+		return fmt.Errorf("invalid git branch %q", o.Branch)
+	}
+
+	_, err = git(root, "rev-parse", "--verify", "-q", "refs/heads/"+o.Branch)
+	if err == nil {
+		return fmt.Errorf("git branch %s already exists", o.Branch)
+	}
+
+	return nil
+}
+
+// validate checks the branch and remote are valid so they can not be mistaken for git options
+func (o *GitInit) validate() error {
+	if o.Branch != "" {
+		_, err := git(os.TempDir(), "check-ref-format", "--branch", o.Branch)
+		if err != nil {
+			return fmt.Errorf("invalid git branch %q", o.Branch)
+		}
+	}
+
+	if strings.HasPrefix(o.RemoteURL, "-") {
+		return fmt.Errorf("invalid git remote url %q", o.RemoteURL)
+	}
+
+	if o.RemoteName != "" {
+		_, err := git(os.TempDir(), "check-ref-format", "refs/remotes/"+o.RemoteName+"/HEAD")
+		if err != nil || strings.HasPrefix(o.RemoteName, "-") {
+			return fmt.Errorf("invalid git remote name %q", o.RemoteName)
+		}
+	}
+
+	return nil
+}
+
+// commitToGit commits the target into a new branch using a temporary index so the working tree and checked out branch are left alone
+func (s *Scaffold) commitToGit(data any) error {
+	opts := s.cfg.Git
+
+	root, err := gitRepositoryRoot(s.cfg.TargetDirectory)
+	if err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("Render scaffold into %s", filepath.Base(s.cfg.TargetDirectory))
+	if opts.Message != "" {
+		msg, err = s.renderCommitMessage(opts.Message, data)
+		if err != nil {
+			return fmt.Errorf("could not render commit message: %w", err)
+		}
+	}
+
+	s.infof(LogAreaGit, "Committing rendered files to git branch %s in %s", opts.Branch, root)
+
+	td, err := os.MkdirTemp("", "scaffold-git")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(td)
+
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(td, "index")}
+
+	// a new repository has no commits so the branch starts from an empty tree
+	parent, err := git(root, "rev-parse", "--verify", "-q", "HEAD^{commit}")
+	if err == nil {
+		_, err = gitWithEnv(root, env, "read-tree", parent)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = gitWithEnv(root, env, "add", "-A", "--", s.cfg.TargetDirectory)
+	if err != nil {
+		return err
+	}
+
+	tree, err := gitWithEnv(root, env, "write-tree")
+	if err != nil {
+		return err
+	}
+
+	args := []string{"commit-tree", tree, "-m", msg}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+
+	commit, err := git(root, args...)
+	if err != nil {
+		return err
+	}
+
+	// the empty old value ensures an existing branch is not overwritten
+	_, err = git(root, "update-ref", "refs/heads/"+opts.Branch, commit, "")
+	if err != nil {
+		return err
+	}
+
+	if opts.Remote == "" {
+		return nil
+	}
+
+	s.infof(LogAreaGit, "Pushing git branch %s to %s", opts.Branch, opts.Remote)
+
+	_, err = git(root, "push", "--set-upstream", "--", opts.Remote, opts.Branch)
+	if err != nil {
+		return err
+	}
+
+	if opts.PullRequestCommand != "" {
+		s.infof(LogAreaGit, "Opening a pull request for git branch %s", opts.Branch)
+
+		err = s.openPullRequest(root, msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openPullRequest runs the pull request command in the repository root
+func (s *Scaffold) openPullRequest(root string, msg string) error {
+	opts := s.cfg.Git
+
+	parts, err := shellquote.Split(opts.PullRequestCommand)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("invalid pull request command %q", opts.PullRequestCommand)
+	}
+
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "SCAFFOLD_GIT_BRANCH="+opts.Branch, "SCAFFOLD_GIT_REMOTE="+opts.Remote, "SCAFFOLD_GIT_MESSAGE="+msg)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("pull request command %q failed: %w: %s", opts.PullRequestCommand, err, strings.TrimSpace(string(out)))
+	}
+
+	s.infof(LogAreaGit, "%s", strings.TrimSpace(string(out)))
+
+	return nil
+}
+
+// renderCommitMessage renders msg using the global settings, overrides of the last rendered file do not apply
+func (s *Scaffold) renderCommitMessage(msg string, data any) (string, error) {
+	s.currentFile = ""
+
+	return s.RenderString(msg, data)
+}
+
+func (s *Scaffold) initGit(data any) error {
+	opts := s.cfg.GitInit
+	target := s.cfg.TargetDirectory
+
+	msg := "Initial scaffold"
+	if opts.Message != "" {
+		var err error
+		msg, err = s.renderCommitMessage(opts.Message, data)
+		if err != nil {
+			return fmt.Errorf("could not render commit message: %w", err)
+		}
+	}
+
+	s.infof(LogAreaGit, "Initializing git repository in %s", target)
+
+	_, err := git(target, "init", "-q")
+	if err != nil {
+		return err
+	}
+
+	if opts.Branch != "" {
+		_, err = git(target, "symbolic-ref", "HEAD", "refs/heads/"+opts.Branch)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = git(target, "add", "-A")
+	if err != nil {
+		return err
+	}
+
+	_, err = git(target, "commit", "-q", "-m", msg)
+	if err != nil {
+		return err
+	}
+
+	if opts.RemoteURL != "" {
+		name := opts.RemoteName
+		if name == "" {
+			name = "origin"
+		}
+
+		_, err = git(target, "remote", "add", "--", name, opts.RemoteURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// gitMetadataDirectory is the target directory or its nearest existing parent, used to query the repository holding the target
+func (s *Scaffold) gitMetadataDirectory() string {
+	return nearestDirectory(s.cfg.TargetDirectory)
+}
+
+// nearestDirectory is dir or its nearest existing parent
+func nearestDirectory(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// gitQuery runs a read-only git command for the repository holding the target, returning an empty string when the
+// target is not in a repository or the command has no result
+func (s *Scaffold) gitQuery(args ...string) string {
+	out, err := git(s.gitMetadataDirectory(), args...)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			s.warnf(LogAreaGit, "Could not query git: %v", err)
+		}
+
+		return ""
+	}
+
+	return out
+}
+
+func (s *Scaffold) gitTemplateFuncs(funcs map[string]any) {
+	funcs["gitRemote"] = func(name ...string) string {
+		remote := "origin"
+		if len(name) > 0 {
+			remote = name[0]
+		}
+
+		return s.gitQuery("remote", "get-url", remote)
+	}
+
+	funcs["gitBranch"] = func() string {
+		return s.gitQuery("symbolic-ref", "--short", "-q", "HEAD")
+	}
+
+	funcs["gitLastTag"] = func() string {
+		return s.gitQuery("describe", "--tags", "--abbrev=0")
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// GitSourceResolver resolves git repository sources like https://github.com/org/scaffold.git//subdir?ref=v1.2.0
+// by cloning them into a cache that is updated on every render
+type GitSourceResolver struct {
+	// CacheDirectory holds the cloned repositories, defaults to scaffold/git in the user cache directory
+	CacheDirectory string
+}
+
+// gitSource is a parsed git source specification
+type gitSource struct {
+	repo   string
+	subdir string
+	ref    string
+}
+
+// parseGitSource parses repo.git//subdir?ref=v1.2.0, reporting false when spec is not a git repository
+func parseGitSource(spec string) (*gitSource, bool) {
+	src := &gitSource{repo: spec}
+
+	if repo, query, ok := strings.Cut(src.repo, "?"); ok {
+		q, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, false
+		}
+		src.repo = repo
+		src.ref = q.Get("ref")
+	}
+
+	start := 0
+	if i := strings.Index(src.repo, "://"); i > -1 {
+		start = i + 3
+	}
+	if i := strings.Index(src.repo[start:], "//"); i > -1 {
+		src.subdir = src.repo[start+i+2:]
+		src.repo = src.repo[:start+i]
+	}
+
+	if !strings.HasSuffix(src.repo, ".git") || !(strings.Contains(src.repo, "://") || strings.Contains(src.repo, "@")) {
+		return nil, false
+	}
+
+	// values starting with - would be parsed as options by git
+	for _, v := range []string{src.repo, src.subdir, src.ref} {
+		if strings.HasPrefix(v, "-") {
+			return nil, false
+		}
+	}
+
+	return src, true
+}
+
+// Resolve implements SourceResolver
+func (g *GitSourceResolver) Resolve(ctx context.Context, spec string) (fs.FS, Cleanup, error) {
+	src, ok := parseGitSource(spec)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid git source %s", spec)
+	}
+
+	subdir := ""
+	if src.subdir != "" {
+		subdir = path.Clean(src.subdir)
+		if !fs.ValidPath(subdir) {
+			return nil, nil, fmt.Errorf("%w: invalid subdirectory %s", ErrPathEscape, src.subdir)
+		}
+	}
+
+	cache, err := g.update(ctx, src.repo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rev := src.ref
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	args := []string{"archive", "--format=tar", "--end-of-options", rev}
+	if subdir != "" {
+		args = append(args, subdir)
+	}
+
+	archive, err := gitOutput(ctx, cache, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	td, err := os.MkdirTemp("", "")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() error { return os.RemoveAll(td) }
+
+	err = extractTar(archive, td)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return os.DirFS(filepath.Join(td, filepath.FromSlash(subdir))), cleanup, nil
+}
+
+// update clones repo into the cache or fetches the latest changes when already cloned, returning the clone path
+func (g *GitSourceResolver) update(ctx context.Context, repo string) (string, error) {
+	cacheDir := g.CacheDirectory
+	if cacheDir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		cacheDir = filepath.Join(userCache, "scaffold", "git")
+	}
+
+	err := os.MkdirAll(cacheDir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(repo))
+	cache := filepath.Join(cacheDir, hex.EncodeToString(sum[:16]))
+
+	_, err = os.Stat(cache)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		_, err = gitOutput(ctx, cacheDir, "clone", "--quiet", "--bare", "--", repo, cache)
+	case err == nil:
+		_, err = gitOutput(ctx, cache, "fetch", "--quiet", "--tags", "--force", "origin", "+refs/heads/*:refs/heads/*")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return cache, nil
+}
+
+func gitOutput(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+// extractTar writes the directories and regular files in archive into target
+func extractTar(archive []byte, target string) error {
+	tr := tar.NewReader(bytes.NewReader(archive))
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !filepath.IsLocal(filepath.FromSlash(hdr.Name)) {
+			return fmt.Errorf("%w: invalid file in source: %v", ErrPathEscape, hdr.Name)
+		}
+		out := filepath.Join(target, filepath.FromSlash(hdr.Name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(out, 0700)
+
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(out), 0700)
+			if err == nil {
+				var content []byte
+				content, err = io.ReadAll(tr)
+				if err == nil {
+					err = os.WriteFile(out, content, 0400)
+				}
+			}
+
+		case tar.TypeXGlobalHeader:
+
+		default:
+			err = fmt.Errorf("invalid file in source: %v", hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
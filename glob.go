@@ -0,0 +1,55 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"path"
+	"strings"
+)
+
+// matchGlob matches the slash separated name against pattern using path.Match rules for each path segment, a ** segment matches zero or more segments
+func matchGlob(pattern string, name string) (bool, error) {
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// validateGlob ensures every segment of pattern is a valid path.Match pattern
+func validateGlob(pattern string) error {
+	for _, seg := range strings.Split(pattern, "/") {
+		_, err := path.Match(seg, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func matchGlobSegments(pattern []string, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				matched, err := matchGlobSegments(pattern[1:], name[i:])
+				if matched || err != nil {
+					return matched, err
+				}
+			}
+
+			return false, nil
+		}
+
+		if len(name) == 0 {
+			return false, nil
+		}
+
+		matched, err := path.Match(pattern[0], name[0])
+		if err != nil || !matched {
+			return false, err
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0, nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+)
+
+// goIdent sanitizes s into a valid Go identifier by replacing invalid characters with underscores
+func goIdent(s string) string {
+	var b strings.Builder
+
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+			b.WriteRune(r)
+		case unicode.IsDigit(r):
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	res := b.String()
+	switch {
+	case res == "":
+		return "_"
+	case token.IsKeyword(res):
+		return res + "_"
+	}
+
+	return res
+}
+
+// goModulePath sanitizes s into a lower case Go module path, spaces become dashes and other invalid characters are removed
+func goModulePath(s string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', strings.ContainsRune("-._~/", r):
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune('-')
+		}
+	}
+
+	parts := strings.FieldsFunc(b.String(), func(r rune) bool { return r == '/' })
+
+	return strings.Join(parts, "/")
+}
+
+// goVersion is the version of Go scaffold was built with like 1.22.5
+func goVersion() string {
+	return strings.TrimPrefix(runtime.Version(), "go")
+}
+
+// formatGo formats content using gofmt rules when FormatGo is set and f is a Go source file
+func (s *Scaffold) formatGo(f string, content []byte) ([]byte, error) {
+	if !s.cfg.FormatGo || filepath.Ext(f) != ".go" {
+		return content, nil
+	}
+
+	res, err := format.Source(content)
+	if err != nil {
+		return nil, fmt.Errorf("formatting %s failed: %w", f, err)
+	}
+
+	return res, nil
+}
@@ -47,6 +47,15 @@ func HermeticHtmlFuncMap() template.FuncMap {
 	return r
 }
 
+// RestrictedTxtFuncMap returns a 'text/template'.FuncMap without functions that access the environment, OS or network.
+func RestrictedTxtFuncMap() ttemplate.FuncMap {
+	r := TxtFuncMap()
+	for _, name := range restrictedFunctions {
+		delete(r, name)
+	}
+	return r
+}
+
 // TxtFuncMap returns a 'text/template'.FuncMap
 func TxtFuncMap() ttemplate.FuncMap {
 	return ttemplate.FuncMap(GenericFuncMap())
@@ -95,6 +104,16 @@ var nonhermeticFunctions = []string{
 	"getHostByName",
 }
 
+// These functions access the environment, OS or network and should not be exposed to untrusted templates.
+var restrictedFunctions = []string{
+	// OS
+	"env",
+	"expandenv",
+
+	// Network
+	"getHostByName",
+}
+
 var genericMap = map[string]interface{}{
 	"hello": func() string { return "Hello!" },
 
@@ -10,26 +10,9 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/choria-io/fisk"
 	"github.com/expr-lang/expr"
 )
 
-// FiskValidator is a fisk.OptionValidator that compatible with Validator() on arguments and flags
-func FiskValidator(validation string) fisk.OptionValidator {
-	return func(value string) error {
-		ok, err := Validate(value, validation)
-		if err != nil {
-			return fmt.Errorf("validation using %q failed: %w", validation, err)
-		}
-
-		if !ok {
-			return fmt.Errorf("validation using %q did not pass", validation)
-		}
-
-		return nil
-	}
-}
-
 // SurveyValidator is a validator for github.com/AlecAivazis/survey
 func SurveyValidator(validation string, required bool) func(any) error {
 	return func(v any) error {
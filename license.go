@@ -0,0 +1,216 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// licenseTexts holds the LICENSE file texts by SPDX identifier, [copyright] is replaced by the copyright line
+//
+//go:embed licenses/*.txt
+var licenseTexts embed.FS
+
+// LicenseHeader adds SPDX license headers to rendered files using the comment syntax of each file type
+type LicenseHeader struct {
+	// SPDX is the SPDX license identifier like Apache-2.0
+	SPDX string `yaml:"spdx"`
+	// Copyright is the copyright line like "Copyright (c) 2024, Example Inc"
+	Copyright string `yaml:"copyright"`
+	// Patterns are slash separated globs relative to the source root selecting files, all files with a known comment syntax when empty
+	Patterns []string `yaml:"patterns"`
+	// License writes a LICENSE file with the text of the SPDX license unless the source renders one,
+	// supported for Apache-2.0, BSD-2-Clause, BSD-3-Clause, ISC and MIT
+	License bool `yaml:"license"`
+}
+
+type commentSyntax struct {
+	start  string
+	prefix string
+	end    string
+}
+
+var (
+	slashComment = commentSyntax{prefix: "//"}
+	hashComment  = commentSyntax{prefix: "#"}
+	dashComment  = commentSyntax{prefix: "--"}
+	cssComment   = commentSyntax{start: "/*", prefix: " *", end: " */"}
+	xmlComment   = commentSyntax{start: "<!--", prefix: " ", end: "-->"}
+)
+
+var commentSyntaxes = map[string]commentSyntax{
+	".go": slashComment, ".c": slashComment, ".h": slashComment, ".cc": slashComment, ".cpp": slashComment,
+	".java": slashComment, ".js": slashComment, ".jsx": slashComment, ".ts": slashComment, ".tsx": slashComment,
+	".rs": slashComment, ".swift": slashComment, ".kt": slashComment, ".scala": slashComment, ".cs": slashComment,
+	".proto": slashComment,
+	".sh":    hashComment, ".bash": hashComment, ".py": hashComment, ".rb": hashComment, ".pl": hashComment,
+	".yaml": hashComment, ".yml": hashComment, ".toml": hashComment, ".tf": hashComment, ".hcl": hashComment,
+	".mk": hashComment, ".conf": hashComment, "Makefile": hashComment, "Dockerfile": hashComment,
+	".sql": dashComment, ".lua": dashComment, ".hs": dashComment,
+	".css": cssComment, ".scss": cssComment,
+	".html": xmlComment, ".xml": xmlComment, ".md": xmlComment,
+}
+
+// fileCommentSyntax finds the comment syntax for the slash separated file name f by extension or full name
+func fileCommentSyntax(f string) (commentSyntax, bool) {
+	base := path.Base(f)
+	if cs, ok := commentSyntaxes[base]; ok {
+		return cs, true
+	}
+
+	cs, ok := commentSyntaxes[path.Ext(base)]
+
+	return cs, ok
+}
+
+// licenseHeader is the SPDX header for the slash separated file name f, empty when the file type is not known
+func licenseHeader(f string, spdx string, copyright string) string {
+	cs, ok := fileCommentSyntax(f)
+	if !ok || spdx == "" {
+		return ""
+	}
+
+	var lines []string
+	if copyright != "" {
+		lines = append(lines, copyright, "")
+	}
+	lines = append(lines, "SPDX-License-Identifier: "+spdx)
+
+	var b strings.Builder
+	if cs.start != "" {
+		fmt.Fprintln(&b, cs.start)
+	}
+	for _, l := range lines {
+		fmt.Fprintln(&b, strings.TrimRight(cs.prefix+" "+l, " "))
+	}
+	if cs.end != "" {
+		fmt.Fprintln(&b, cs.end)
+	}
+
+	return b.String()
+}
+
+// addLicenseHeader prepends the configured license header to content for the slash separated source file rel,
+// files that already have a SPDX identifier are left unchanged and shebang lines are kept first
+func (s *Scaffold) addLicenseHeader(rel string, content []byte) []byte {
+	lh := s.cfg.LicenseHeader
+	if lh == nil || rel == "" || bytes.Contains(content, []byte("SPDX-License-Identifier:")) {
+		return content
+	}
+
+	if len(lh.Patterns) > 0 {
+		selected := false
+		for _, p := range lh.Patterns {
+			if matched, _ := matchGlob(p, rel); matched {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			return content
+		}
+	}
+
+	header := licenseHeader(rel, lh.SPDX, lh.Copyright)
+	if header == "" {
+		return content
+	}
+
+	end := prologEnd(content)
+	prolog := string(content[:end])
+	if prolog != "" && !strings.HasSuffix(prolog, "\n") {
+		prolog += "\n"
+	}
+
+	return []byte(prolog + header + "\n" + string(content[end:]))
+}
+
+// prologEnd is the length of the shebang line or XML declaration and doctype that have to stay at the start of content
+func prologEnd(content []byte) int {
+	if bytes.HasPrefix(content, []byte("#!")) {
+		i := bytes.IndexByte(content, '\n')
+		if i < 0 {
+			return len(content)
+		}
+		return i + 1
+	}
+
+	end := 0
+	for {
+		rest := content[end:]
+		lower := bytes.ToLower(rest)
+
+		var n int
+		switch {
+		case bytes.HasPrefix(rest, []byte("<?xml")):
+			n = bytes.Index(rest, []byte("?>")) + len("?>")
+		case bytes.HasPrefix(lower, []byte("<!doctype")):
+			n = bytes.IndexByte(rest, '>') + 1
+			if i := bytes.IndexByte(rest, '['); i >= 0 && i < n {
+				n = bytes.Index(rest, []byte("]>")) + len("]>")
+			}
+		default:
+			return end
+		}
+
+		// unterminated declarations are left for the parser of the file to report
+		if n <= 1 {
+			return end
+		}
+
+		end += n
+		switch {
+		case bytes.HasPrefix(content[end:], []byte("\r\n")):
+			end += 2
+		case bytes.HasPrefix(content[end:], []byte("\n")):
+			end++
+		}
+	}
+}
+
+// hasLicenseText determines if a LICENSE file can be written for the SPDX identifier spdx
+func hasLicenseText(spdx string) bool {
+	_, err := licenseTexts.ReadFile("licenses/" + spdx + ".txt")
+	return err == nil
+}
+
+// licenseText is the LICENSE file for the SPDX identifier spdx, without a copyright line the placeholder is removed
+func licenseText(spdx string, copyright string) (string, error) {
+	text, err := licenseTexts.ReadFile("licenses/" + spdx + ".txt")
+	if err != nil {
+		return "", fmt.Errorf("no license text for %s", spdx)
+	}
+
+	if copyright == "" {
+		return strings.Replace(string(text), "[copyright]\n\n", "", 1), nil
+	}
+
+	return strings.Replace(string(text), "[copyright]", copyright, 1), nil
+}
+
+// writeLicense writes the LICENSE file into the target directory unless the source rendered one
+func (s *Scaffold) writeLicense() error {
+	lh := s.cfg.LicenseHeader
+	out := s.targetPath("LICENSE")
+
+	abs, err := s.targetFile(out)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.written[strings.ToLower(abs)]; ok {
+		return nil
+	}
+
+	text, err := licenseText(lh.SPDX, lh.Copyright)
+	if err != nil {
+		return err
+	}
+
+	return s.saveAndRecordFile(out, text)
+}
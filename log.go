@@ -0,0 +1,112 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// LogLevel is the minimum level of messages passed to the Logger
+type LogLevel int
+
+const (
+	// DebugLevel logs all messages
+	DebugLevel LogLevel = iota
+	// InfoLevel logs informational messages and warnings, the default
+	InfoLevel
+	// WarnLevel logs only warnings
+	WarnLevel
+)
+
+// LogArea is a part of the scaffold process that produces log messages
+type LogArea string
+
+const (
+	// LogAreaRender covers rendering templates and writing files
+	LogAreaRender LogArea = "render"
+	// LogAreaPost covers post-processing of rendered files
+	LogAreaPost LogArea = "post"
+	// LogAreaGit covers git output
+	LogAreaGit LogArea = "git"
+)
+
+// WarnLogger is a Logger that supports warnings, when the Logger does not implement it warnings are logged using Infof
+type WarnLogger interface {
+	Logger
+	Warnf(format string, v ...any)
+}
+
+// LogLevel sets the minimum level of messages to log, defaults to InfoLevel
+func (s *Scaffold) LogLevel(level LogLevel) {
+	s.logLevel = level
+}
+
+// DisableLogAreas disables logging for parts of the scaffold process, warnings are always logged
+func (s *Scaffold) DisableLogAreas(areas ...LogArea) {
+	if s.disabledLogAreas == nil {
+		s.disabledLogAreas = make(map[LogArea]bool)
+	}
+
+	for _, area := range areas {
+		s.disabledLogAreas[area] = true
+	}
+}
+
+func (s *Scaffold) shouldLog(area LogArea, level LogLevel) bool {
+	if s.log == nil || level < s.logLevel {
+		return false
+	}
+
+	return level == WarnLevel || !s.disabledLogAreas[area]
+}
+
+func (s *Scaffold) debugf(area LogArea, format string, v ...any) {
+	if s.shouldLog(area, DebugLevel) {
+		s.log.Debugf("%s", s.redact(fmt.Sprintf(format, v...)))
+	}
+}
+
+func (s *Scaffold) infof(area LogArea, format string, v ...any) {
+	if s.shouldLog(area, InfoLevel) {
+		s.log.Infof("%s", s.redact(fmt.Sprintf(format, v...)))
+	}
+}
+
+func (s *Scaffold) warnf(area LogArea, format string, v ...any) {
+	if !s.shouldLog(area, WarnLevel) {
+		return
+	}
+
+	msg := s.redact(fmt.Sprintf(format, v...))
+
+	if wl, ok := s.log.(WarnLogger); ok {
+		wl.Warnf("%s", msg)
+	} else {
+		s.log.Infof("%s", msg)
+	}
+}
+
+type slogLogger struct {
+	log *slog.Logger
+}
+
+// NewSlogLogger creates a Logger that logs using log, for example with a slog.JSONHandler for structured logs
+func NewSlogLogger(log *slog.Logger) WarnLogger {
+	return &slogLogger{log: log}
+}
+
+func (l *slogLogger) logf(level slog.Level, format string, v ...any) {
+	if !l.log.Enabled(context.Background(), level) {
+		return
+	}
+
+	l.log.Log(context.Background(), level, fmt.Sprintf(format, v...))
+}
+
+func (l *slogLogger) Debugf(format string, v ...any) { l.logf(slog.LevelDebug, format, v...) }
+func (l *slogLogger) Infof(format string, v ...any)  { l.logf(slog.LevelInfo, format, v...) }
+func (l *slogLogger) Warnf(format string, v ...any)  { l.logf(slog.LevelWarn, format, v...) }
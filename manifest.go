@@ -0,0 +1,140 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const manifestFileName = "scaffold.yaml"
+
+// Manifest describes a scaffold, it is read from scaffold.yaml in the root of the source when Config.UseManifest is set and is not rendered
+type Manifest struct {
+	// Name is the name of the scaffold
+	Name string `yaml:"name"`
+	// Version is the version of the scaffold
+	Version string `yaml:"version"`
+	// Description describes what the scaffold creates
+	Description string `yaml:"description"`
+	// Required are top level data keys that must be supplied when rendering
+	Required []string `yaml:"required"`
+	// PostRules are added to Config.PostRules, they are ignored with Config.RestrictedFunctions as they run commands
+	PostRules []PostRule `yaml:"post_rules"`
+	// Overrides change rendering settings for source files matching globs, Config.Overrides take precedence
+	Overrides []FileOverride `yaml:"overrides"`
+	// LicenseHeader is used when Config.LicenseHeader is not set
+	LicenseHeader *LicenseHeader `yaml:"license_header"`
+	// LeftDelimiter is used when Config.CustomLeftDelimiter is not set
+	LeftDelimiter string `yaml:"left_delimiter"`
+	// RightDelimiter is used when Config.CustomRightDelimiter is not set
+	RightDelimiter string `yaml:"right_delimiter"`
+}
+
+// loadManifest reads the manifest from a local source directory or in-memory source, returns nil when there is none
+func (c *Config) loadManifest() (*Manifest, error) {
+	var mf []byte
+
+	switch {
+	case c.SourceDirectory != "":
+		var err error
+		mf, err = os.ReadFile(filepath.Join(c.SourceDirectory, manifestFileName))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		switch e := c.Source[manifestFileName].(type) {
+		case nil:
+			return nil, nil
+		case string:
+			mf = []byte(e)
+		case []byte:
+			mf = e
+		default:
+			return nil, fmt.Errorf("invalid %s: must be a string or []byte", manifestFileName)
+		}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(mf))
+	dec.KnownFields(true)
+
+	var manifest Manifest
+	err := dec.Decode(&manifest)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid %s: %w", manifestFileName, err)
+	}
+
+	if (manifest.LeftDelimiter == "") != (manifest.RightDelimiter == "") {
+		return nil, fmt.Errorf("invalid %s: both delimiters must be set", manifestFileName)
+	}
+
+	return &manifest, nil
+}
+
+// mergeManifest adds the manifest settings to the configuration, settings in the configuration take precedence
+func (c *Config) mergeManifest(m *Manifest) {
+	if c.CustomLeftDelimiter == "" && c.CustomRightDelimiter == "" {
+		c.CustomLeftDelimiter = m.LeftDelimiter
+		c.CustomRightDelimiter = m.RightDelimiter
+	}
+
+	if c.LicenseHeader == nil {
+		c.LicenseHeader = m.LicenseHeader
+	}
+
+	c.Overrides = append(append([]FileOverride{}, m.Overrides...), c.Overrides...)
+
+	if !c.RestrictedFunctions {
+		c.PostRules = append(append([]PostRule{}, m.PostRules...), c.PostRules...)
+	}
+}
+
+// missingRequired lists the keys required by the manifest that are not in data
+func (m *Manifest) missingRequired(data any) []string {
+	have := map[string]bool{}
+	for _, k := range dataKeys(data) {
+		have[k] = true
+	}
+
+	var missing []string
+	for _, k := range m.Required {
+		if !have[k] {
+			missing = append(missing, k)
+		}
+	}
+
+	return missing
+}
+
+// checkRequired ensures data holds every key the manifest requires
+func (s *Scaffold) checkRequired(data any) error {
+	if s.manifest == nil {
+		return nil
+	}
+
+	missing := s.manifest.missingRequired(data)
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrRequiredData, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// Manifest is the scaffold.yaml found in the root of the source, nil when there is none or Config.UseManifest is not set
+func (s *Scaffold) Manifest() *Manifest {
+	return s.manifest
+}
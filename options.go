@@ -0,0 +1,61 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"fmt"
+)
+
+// RenderOption configures a single render
+type RenderOption func(*renderOptions) error
+
+type renderOptions struct {
+	only []string
+}
+
+// WithOnly renders only source files matching any of the slash separated globs relative to the source root,
+// ** matches any number of directories
+func WithOnly(globs ...string) RenderOption {
+	return func(o *renderOptions) error {
+		for _, g := range globs {
+			err := validateGlob(g)
+			if err != nil {
+				return fmt.Errorf("invalid glob %q: %w", g, err)
+			}
+		}
+
+		o.only = append(o.only, globs...)
+
+		return nil
+	}
+}
+
+func newRenderOptions(opts ...RenderOption) (*renderOptions, error) {
+	ro := &renderOptions{}
+	for _, opt := range opts {
+		err := opt(ro)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ro, nil
+}
+
+// selected determines if the slash separated path rel should be rendered
+func (o *renderOptions) selected(rel string) bool {
+	if len(o.only) == 0 {
+		return true
+	}
+
+	for _, g := range o.only {
+		matched, _ := matchGlob(g, rel)
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
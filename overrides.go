@@ -0,0 +1,82 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"fmt"
+)
+
+// FileOverride changes how source files matching Pattern are rendered, later overrides take precedence
+type FileOverride struct {
+	// Pattern is a slash separated glob relative to the source root, ** matches any number of directories
+	Pattern string `yaml:"pattern"`
+	// LeftDelimiter is the template delimiter for matching files, requires RightDelimiter
+	LeftDelimiter string `yaml:"left_delimiter"`
+	// RightDelimiter is the template delimiter for matching files, requires LeftDelimiter
+	RightDelimiter string `yaml:"right_delimiter"`
+	// SkipEmpty overrides the SkipEmpty setting for matching files when set
+	SkipEmpty *bool `yaml:"skip_empty"`
+	// Raw copies matching files without template processing
+	Raw bool `yaml:"raw"`
+}
+
+// renderSettings are the settings used to render a single template
+type renderSettings struct {
+	leftDelimiter  string
+	rightDelimiter string
+	skipEmpty      bool
+	raw            bool
+}
+
+func (o FileOverride) validate() error {
+	if o.Pattern == "" {
+		return fmt.Errorf("file overrides require a pattern")
+	}
+
+	err := validateGlob(o.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid file override pattern %q: %w", o.Pattern, err)
+	}
+
+	if (o.LeftDelimiter == "") != (o.RightDelimiter == "") {
+		return fmt.Errorf("file override %q requires both delimiters", o.Pattern)
+	}
+
+	return nil
+}
+
+// renderSettings are the settings for the slash separated source file rel with all matching overrides applied,
+// an empty rel gives the global settings
+func (s *Scaffold) renderSettings(rel string) renderSettings {
+	res := renderSettings{skipEmpty: s.cfg.SkipEmpty}
+	if s.cfg.CustomLeftDelimiter != "" && s.cfg.CustomRightDelimiter != "" {
+		res.leftDelimiter = s.cfg.CustomLeftDelimiter
+		res.rightDelimiter = s.cfg.CustomRightDelimiter
+	}
+
+	if rel == "" {
+		return res
+	}
+
+	for _, o := range s.cfg.Overrides {
+		matched, _ := matchGlob(o.Pattern, rel)
+		if !matched {
+			continue
+		}
+
+		if o.LeftDelimiter != "" {
+			res.leftDelimiter = o.LeftDelimiter
+			res.rightDelimiter = o.RightDelimiter
+		}
+		if o.SkipEmpty != nil {
+			res.skipEmpty = *o.SkipEmpty
+		}
+		if o.Raw {
+			res.raw = true
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kballard/go-shellquote"
+	"gopkg.in/yaml.v3"
+)
+
+// PostRule is a post-processing step executed after all files were rendered
+type PostRule struct {
+	// Pattern is a glob matched against the name of rendered files, patterns containing / like helm/**/*.yaml are matched
+	// against the slash separated path relative to the target with ** matching any number of directories. When empty the
+	// command is run once in the target directory
+	Pattern string `yaml:"pattern"`
+	// Command is the command to run, {} is replaced with the file path else the path is appended to the arguments
+	Command string `yaml:"command"`
+	// Stage orders rules, lower stages run first and rules in the same stage run in the order given with per-file rules before others
+	Stage int `yaml:"stage"`
+	// Retries is how many times a failed command is retried
+	Retries int `yaml:"retries"`
+	// AllowFailure records a failing command as a warning in the report rather than failing the render
+	AllowFailure bool `yaml:"allow_failure"`
+	// Env are additional environment variables set for the command
+	Env map[string]string `yaml:"env"`
+	// WorkingDirectory is where the command is run relative to the target directory, defaults to the target directory
+	WorkingDirectory string `yaml:"working_directory"`
+	// Batch runs the command once with all matching files rather than once per file
+	Batch bool `yaml:"batch"`
+}
+
+// LoadPostRules reads post-processing rules from a YAML file holding a list of rules
+func LoadPostRules(file string) ([]PostRule, error) {
+	f, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(f))
+	dec.KnownFields(true)
+
+	var rules []PostRule
+	err = dec.Decode(&rules)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid post processing rules in %s: %w", file, err)
+	}
+
+	for _, rule := range rules {
+		err = rule.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid post processing rules in %s: %w", file, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// validate checks the rule has a command and a valid pattern and working directory
+func (r PostRule) validate() error {
+	if r.Command == "" {
+		return fmt.Errorf("post processing rules require a command")
+	}
+
+	err := validateGlob(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid post processing pattern %q: %w", r.Pattern, err)
+	}
+
+	if r.WorkingDirectory != "" && !filepath.IsLocal(r.WorkingDirectory) {
+		return fmt.Errorf("%w: invalid post processing working directory %s", ErrPathEscape, r.WorkingDirectory)
+	}
+
+	return nil
+}
+
+// postRules combines Post, PostRules and rules added using addPost ordered by stage
+func (s *Scaffold) postRules() []PostRule {
+	var rules []PostRule
+
+	for _, p := range s.cfg.Post {
+		globs := make([]string, 0, len(p))
+		for g := range p {
+			globs = append(globs, g)
+		}
+		sort.Strings(globs)
+
+		for _, g := range globs {
+			rules = append(rules, PostRule{Pattern: g, Command: p[g]})
+		}
+	}
+
+	rules = append(rules, s.cfg.PostRules...)
+	rules = append(rules, s.dynamicPost...)
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Stage < rules[j].Stage
+	})
+
+	return rules
+}
+
+func (s *Scaffold) postProcess() error {
+	rules := s.postRules()
+
+	for len(rules) > 0 {
+		stage := rules[0].Stage
+		end := sort.Search(len(rules), func(i int) bool { return rules[i].Stage > stage })
+
+		for _, rule := range rules[:end] {
+			if rule.Pattern == "" {
+				continue
+			}
+
+			var matches []int
+			for i, f := range s.report.Files {
+				if f.Action == FileActionSkipped {
+					continue
+				}
+
+				matched, err := rule.matches(f.Path)
+				if err != nil {
+					return err
+				}
+
+				if matched {
+					matches = append(matches, i)
+				}
+			}
+
+			if rule.Batch {
+				if len(matches) == 0 {
+					continue
+				}
+
+				var files []string
+				for _, i := range matches {
+					files = append(files, filepath.Join(s.cfg.TargetDirectory, filepath.FromSlash(s.report.Files[i].Path)))
+				}
+
+				res, err := s.runPostCommand(rule, files...)
+				if err != nil {
+					return err
+				}
+
+				for _, i := range matches {
+					s.report.Files[i].Post = append(s.report.Files[i].Post, *res)
+				}
+
+				continue
+			}
+
+			for _, i := range matches {
+				res, err := s.runPostCommand(rule, filepath.Join(s.cfg.TargetDirectory, filepath.FromSlash(s.report.Files[i].Path)))
+				if err != nil {
+					return err
+				}
+
+				s.report.Files[i].Post = append(s.report.Files[i].Post, *res)
+			}
+		}
+
+		for _, rule := range rules[:end] {
+			if rule.Pattern != "" {
+				continue
+			}
+
+			res, err := s.runPostCommand(rule, s.cfg.TargetDirectory)
+			if err != nil {
+				return err
+			}
+
+			s.report.Post = append(s.report.Post, *res)
+		}
+
+		rules = rules[end:]
+	}
+
+	return nil
+}
+
+// runPostCommand runs the command for rule against files, batch rules receive all matching files at once
+func (s *Scaffold) runPostCommand(rule PostRule, files ...string) (*PostCommand, error) {
+	f := strings.Join(files, " ")
+
+	parts, err := shellquote.Split(strings.ReplaceAll(rule.Command, "{}", shellquote.Join(files...)))
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("invalid post processing command %q", rule.Command)
+	}
+
+	cmd := parts[0]
+	if s.cfg.WorkingDirectory != "" && strings.ContainsRune(cmd, filepath.Separator) && !filepath.IsAbs(cmd) {
+		cmd = filepath.Join(s.cfg.WorkingDirectory, cmd)
+	}
+
+	var args []string
+	if len(parts) > 1 {
+		args = append(args, parts[1:]...)
+	}
+
+	if rule.Pattern != "" && !strings.Contains(rule.Command, "{}") {
+		args = append(args, files...)
+	}
+
+	dir := s.cfg.TargetDirectory
+	if rule.WorkingDirectory != "" {
+		dir = filepath.Join(dir, rule.WorkingDirectory)
+	}
+
+	var env []string
+	if len(rule.Env) > 0 {
+		keys := make([]string, 0, len(rule.Env))
+		for k := range rule.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		env = os.Environ()
+		for _, k := range keys {
+			env = append(env, k+"="+rule.Env[k])
+		}
+	}
+
+	command := strings.TrimSpace(cmd + " " + strings.Join(args, " "))
+
+	if s.noop {
+		s.infof(LogAreaPost, "Would post process using: %s", command)
+		return &PostCommand{Command: command}, nil
+	}
+
+	s.infof(LogAreaPost, "Post processing using: %s", command)
+
+	var out []byte
+	var start time.Time
+
+	for try := 0; try <= rule.Retries; try++ {
+		if try > 0 {
+			s.warnf(LogAreaPost, "Retrying post processing of %s, attempt %d of %d", f, try, rule.Retries)
+		}
+
+		start = time.Now()
+		ec := exec.Command(cmd, args...)
+		ec.Dir = dir
+		ec.Env = env
+
+		out, err = ec.CombinedOutput()
+		if err == nil {
+			break
+		}
+	}
+
+	s.debugf(LogAreaPost, "Post processing output: %q", out)
+
+	res := &PostCommand{
+		Command:  command,
+		Output:   string(out),
+		Duration: time.Since(start),
+	}
+
+	if err != nil {
+		res.ExitCode = -1
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			res.ExitCode = exitErr.ExitCode()
+		}
+
+		if !rule.AllowFailure {
+			return nil, fmt.Errorf("%w %s\nerror: %w\noutput: %q", ErrPostProcessFailed, f, err, out)
+		}
+
+		warning := fmt.Sprintf("post processing %s using %q failed: %v: %q", f, rule.Command, err, out)
+		s.report.Warnings = append(s.report.Warnings, warning)
+
+		s.warnf(LogAreaPost, "Ignoring failed post processing: %s", warning)
+	}
+
+	return res, nil
+}
+
+// matches determines if the slash separated path rel relative to the target matches the rule pattern
+func (r PostRule) matches(rel string) (bool, error) {
+	if strings.Contains(r.Pattern, "/") {
+		return matchGlob(r.Pattern, rel)
+	}
+
+	return path.Match(r.Pattern, path.Base(rel))
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// redactedValue replaces sensitive values in logs, reports and errors
+const redactedValue = "***"
+
+// minRedactedSubstring is the shortest sensitive value replaced inside other words, shorter values are only
+// replaced as whole words so they do not corrupt unrelated text
+const minRedactedSubstring = 4
+
+// redactedError hides sensitive values in the message of err while keeping it available to errors.Is and errors.As
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// sensitiveValues finds the values of the dot separated SensitiveKeys in data, boolean values are not redacted as
+// they can not be told apart from other text
+func sensitiveValues(data any, keys []string) []string {
+	var res []string
+
+	for _, k := range keys {
+		var val any = data
+		for _, part := range strings.Split(k, ".") {
+			m, ok := val.(map[string]any)
+			if !ok {
+				val = nil
+				break
+			}
+			val = m[part]
+		}
+
+		switch v := val.(type) {
+		case nil, bool, map[string]any, []any:
+		default:
+			s := fmt.Sprint(v)
+			if _, err := strconv.ParseBool(s); s != "" && err != nil {
+				res = append(res, s)
+			}
+		}
+	}
+
+	return res
+}
+
+// useSecrets redacts the sensitive values in data until the returned function is called, values from enclosing
+// calls stay redacted
+func (s *Scaffold) useSecrets(data any) func() {
+	prev := s.secrets
+
+	secrets := append(sensitiveValues(data, s.cfg.SensitiveKeys), prev...)
+	sort.SliceStable(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	s.secrets = secrets
+
+	return func() { s.secrets = prev }
+}
+
+// redact replaces sensitive values in s
+func (s *Scaffold) redact(str string) string {
+	for _, v := range s.secrets {
+		if utf8.RuneCountInString(v) < minRedactedSubstring {
+			str = replaceWord(str, v, redactedValue)
+		} else {
+			str = strings.ReplaceAll(str, v, redactedValue)
+		}
+	}
+
+	return str
+}
+
+// replaceWord replaces occurrences of word in str that are not part of a longer word
+func replaceWord(str string, word string, replacement string) string {
+	isWord := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+	var b strings.Builder
+	last := 0
+
+	for start := 0; start < len(str); {
+		i := strings.Index(str[start:], word)
+		if i < 0 {
+			break
+		}
+		i += start
+		end := i + len(word)
+
+		before, _ := utf8.DecodeLastRuneInString(str[:i])
+		after, _ := utf8.DecodeRuneInString(str[end:])
+		if !isWord(before) && !isWord(after) {
+			b.WriteString(str[last:i])
+			b.WriteString(replacement)
+			last = end
+		}
+
+		start = end
+	}
+
+	b.WriteString(str[last:])
+
+	return b.String()
+}
+
+// redactError hides sensitive values in the message of err
+func (s *Scaffold) redactError(err error) error {
+	if err == nil || len(s.secrets) == 0 {
+		return err
+	}
+
+	msg := s.redact(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+
+	return &redactedError{err: err, msg: msg}
+}
+
+// redactReport hides sensitive values in post-processing commands, their output and warnings
+func (s *Scaffold) redactReport(r *RenderReport) {
+	if r == nil || len(s.secrets) == 0 {
+		return
+	}
+
+	redactPost := func(cmds []PostCommand) {
+		for i := range cmds {
+			cmds[i].Command = s.redact(cmds[i].Command)
+			cmds[i].Output = s.redact(cmds[i].Output)
+		}
+	}
+
+	for i := range r.Files {
+		redactPost(r.Files[i].Post)
+	}
+	redactPost(r.Post)
+
+	for i := range r.Warnings {
+		r.Warnings[i] = s.redact(r.Warnings[i])
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileAction describes what happened to a file during rendering
+type FileAction string
+
+const (
+	// FileActionAdd is a file that was added to the target
+	FileActionAdd FileAction = "add"
+	// FileActionSkipped is a file that was intentionally not written, see ManagedFile.Reason
+	FileActionSkipped FileAction = "skipped"
+)
+
+const (
+	// SkipReasonEmpty is a file that rendered empty while SkipEmpty applied
+	SkipReasonEmpty = "empty"
+	// SkipReasonNotSelected is a file that did not match the WithOnly render option
+	SkipReasonNotSelected = "not selected"
+)
+
+// PostCommand is a post-processing command that was executed against a file
+type PostCommand struct {
+	// Command is the command that was run including its arguments
+	Command string `json:"command"`
+	// Output is the combined standard output and standard error of the command
+	Output string `json:"output,omitempty"`
+	// ExitCode is the exit code of the command, -1 when it could not be run
+	ExitCode int `json:"exit_code"`
+	// Duration is how long the command took to complete
+	Duration time.Duration `json:"duration"`
+}
+
+// ManagedFile is a file that was processed during rendering
+type ManagedFile struct {
+	// Path is the slash separated path relative to the target directory
+	Path string `json:"path"`
+	// Action is what happened to the file
+	Action FileAction `json:"action"`
+	// Size is the number of bytes written
+	Size int64 `json:"size"`
+	// Reason is why a file with FileActionSkipped was not written
+	Reason string `json:"reason,omitempty"`
+	// Post lists the post-processing commands that were run against the file
+	Post []PostCommand `json:"post,omitempty"`
+	// Duration is how long rendering the file took
+	Duration time.Duration `json:"duration"`
+	// Trace lists the template functions called while rendering the file when tracing is enabled
+	Trace []TraceEntry `json:"trace,omitempty"`
+}
+
+// RenderReport summarizes a render
+type RenderReport struct {
+	// Target is the directory that was rendered into
+	Target string `json:"target"`
+	// Files are the files that were written to the target
+	Files []ManagedFile `json:"files"`
+	// Directories are directories created by the mkdir template function, relative to the target directory
+	Directories []string `json:"directories,omitempty"`
+	// Skipped are files that were not written because they were empty, relative to the target directory
+	Skipped []string `json:"skipped,omitempty"`
+	// Post lists the post-processing commands that were run once in the target directory
+	Post []PostCommand `json:"post,omitempty"`
+	// Noop indicates the render was done using RenderNoop, files were not written and post-processing commands were not run
+	Noop bool `json:"noop,omitempty"`
+	// Warnings are problems encountered that did not fail the render
+	Warnings []string `json:"warnings,omitempty"`
+	// Started is when rendering started
+	Started time.Time `json:"started"`
+	// Duration is how long the whole render took
+	Duration time.Duration `json:"duration"`
+}
+
+// RenderStats are aggregate counts for a render, every written file is added as the target may not exist before rendering
+type RenderStats struct {
+	// Added is the number of files added to the target
+	Added int `json:"added"`
+	// Skipped is the number of files intentionally not written
+	Skipped int `json:"skipped"`
+	// Bytes is the total size of all files written
+	Bytes int64 `json:"bytes"`
+	// Duration is how long the whole render took
+	Duration time.Duration `json:"duration"`
+}
+
+func newRenderReport(target string) *RenderReport {
+	return &RenderReport{
+		Target:  target,
+		Files:   []ManagedFile{},
+		Started: time.Now(),
+	}
+}
+
+func (r *RenderReport) relativePath(f string) string {
+	rel, err := filepath.Rel(r.Target, f)
+	if err != nil {
+		return filepath.ToSlash(f)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// Stats calculates aggregate counts for the files in the report
+func (r *RenderReport) Stats() RenderStats {
+	stats := RenderStats{
+		Duration: r.Duration,
+	}
+
+	for _, f := range r.Files {
+		switch f.Action {
+		case FileActionAdd:
+			stats.Added++
+		case FileActionSkipped:
+			stats.Skipped++
+		}
+		stats.Bytes += f.Size
+	}
+
+	return stats
+}
+
+// Summary is a single line summary of the report like "3 added, 1 skipped, 120 bytes in 2ms"
+func (r *RenderReport) Summary() string {
+	stats := r.Stats()
+
+	return fmt.Sprintf("%d added, %d skipped, %d bytes in %v", stats.Added, stats.Skipped, stats.Bytes, stats.Duration.Round(time.Millisecond))
+}
+
+// Markdown renders the report as a markdown document
+func (r *RenderReport) Markdown() string {
+	buf := bytes.NewBuffer([]byte{})
+
+	fmt.Fprintf(buf, "# Render Report\n\n")
+	fmt.Fprintf(buf, " * Target: `%s`\n", r.Target)
+	if r.Noop {
+		fmt.Fprintf(buf, " * Noop: post commands were not run\n")
+	}
+	fmt.Fprintf(buf, " * Started: %s\n", r.Started.Format(time.RFC3339))
+	fmt.Fprintf(buf, " * Duration: %v\n", r.Duration)
+	fmt.Fprintf(buf, " * Files: %d\n", len(r.Files))
+	fmt.Fprintf(buf, " * Summary: %s\n", r.Summary())
+	fmt.Fprintf(buf, " * Skipped: %d\n", len(r.Skipped))
+	fmt.Fprintf(buf, " * Warnings: %d\n", len(r.Warnings))
+
+	if len(r.Files) > 0 {
+		fmt.Fprintf(buf, "\n## Files\n\n")
+		fmt.Fprintf(buf, "| Path | Action | Duration | Post Commands |\n")
+		fmt.Fprintf(buf, "|------|--------|----------|---------------|\n")
+		for _, f := range r.Files {
+			var post []string
+			for _, p := range f.Post {
+				post = append(post, fmt.Sprintf("`%s` (exit %d, %v)", p.Command, p.ExitCode, p.Duration))
+			}
+
+			fmt.Fprintf(buf, "| `%s` | %s | %v | %s |\n", f.Path, f.Action, f.Duration, strings.Join(post, "<br>"))
+		}
+	}
+
+	if len(r.Directories) > 0 {
+		fmt.Fprintf(buf, "\n## Directories\n\n")
+		for _, d := range r.Directories {
+			fmt.Fprintf(buf, " * `%s`\n", d)
+		}
+	}
+
+	if len(r.Post) > 0 {
+		fmt.Fprintf(buf, "\n## Post Commands\n\n")
+		for _, p := range r.Post {
+			fmt.Fprintf(buf, " * `%s` (exit %d, %v)\n", p.Command, p.ExitCode, p.Duration)
+		}
+	}
+
+	if len(r.Warnings) > 0 {
+		fmt.Fprintf(buf, "\n## Warnings\n\n")
+		for _, w := range r.Warnings {
+			fmt.Fprintf(buf, " * %s\n", w)
+		}
+	}
+
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(buf, "\n## Skipped\n\n")
+		for _, f := range r.Skipped {
+			fmt.Fprintf(buf, " * `%s`\n", f)
+		}
+	}
+
+	return buf.String()
+}
+
+// WriteFile saves the report to file, files with a .md extension are saved as Markdown, others as JSON
+func (r *RenderReport) WriteFile(file string) error {
+	var out []byte
+	var err error
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".md", ".markdown":
+		out = []byte(r.Markdown())
+	default:
+		out, err = json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(file, out, 0644)
+}
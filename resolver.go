@@ -0,0 +1,140 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Cleanup releases resources held by a resolved source
+type Cleanup func() error
+
+// SourceResolver resolves source specifications like s3://bucket/path into a filesystem holding the templates
+type SourceResolver interface {
+	// Resolve fetches the source described by spec, cleanup is called once rendering is done and may be nil
+	Resolve(ctx context.Context, spec string) (source fs.FS, cleanup Cleanup, err error)
+}
+
+var (
+	sourceResolvers = map[string]SourceResolver{}
+	resolversMu     sync.Mutex
+)
+
+// RegisterSourceResolver registers a resolver for SourceDirectory values starting with scheme://
+func RegisterSourceResolver(scheme string, resolver SourceResolver) error {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+
+	if scheme == "" || strings.Contains(scheme, "://") {
+		return fmt.Errorf("invalid source resolver scheme %q", scheme)
+	}
+
+	if _, ok := sourceResolvers[scheme]; ok {
+		return fmt.Errorf("source resolver for %s:// already registered", scheme)
+	}
+
+	sourceResolvers[scheme] = resolver
+
+	return nil
+}
+
+// sourceResolver finds the registered resolver for a SourceDirectory like scheme://location, git repositories
+// without a registered resolver use GitSourceResolver
+func sourceResolver(cfg *Config) (SourceResolver, bool) {
+	spec := cfg.SourceDirectory
+
+	scheme, _, ok := strings.Cut(spec, "://")
+	if ok {
+		resolversMu.Lock()
+		r, ok := sourceResolvers[scheme]
+		resolversMu.Unlock()
+
+		if ok {
+			return r, true
+		}
+	}
+
+	if _, ok := parseGitSource(spec); ok {
+		return &GitSourceResolver{CacheDirectory: cfg.SourceCacheDirectory}, true
+	}
+
+	return nil, false
+}
+
+// resolveSource resolves the source using resolver and copies it into a temporary directory
+func (s *Scaffold) resolveSource(ctx context.Context, resolver SourceResolver, spec string) (string, error) {
+	source, cleanup, err := resolver.Resolve(ctx, spec)
+	if err != nil {
+		return "", fmt.Errorf("%w: could not resolve %s: %w", ErrSourceUnavailable, spec, err)
+	}
+	if cleanup != nil {
+		defer func() {
+			err := cleanup()
+			if err != nil {
+				s.warnf(LogAreaRender, "Cleaning up source %s failed: %v", spec, err)
+			}
+		}()
+	}
+	if source == nil {
+		return "", fmt.Errorf("%w: resolving %s did not return a source", ErrSourceUnavailable, spec)
+	}
+
+	td, err := os.MkdirTemp("", "")
+	if err != nil {
+		return "", err
+	}
+
+	err = s.copySourceFS(source, td)
+	if err != nil {
+		os.RemoveAll(td)
+		return "", err
+	}
+
+	return td, nil
+}
+
+func (s *Scaffold) copySourceFS(source fs.FS, target string) error {
+	maxFiles := s.cfg.MaxSourceFiles
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxSourceFiles
+	}
+
+	files := 0
+
+	return fs.WalkDir(source, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		out := filepath.Join(target, filepath.FromSlash(path))
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(out, 0700)
+
+		case d.Type().IsRegular():
+			files++
+			if files > maxFiles {
+				return fmt.Errorf("source exceeds the maximum of %d files", maxFiles)
+			}
+
+			content, err := fs.ReadFile(source, path)
+			if err != nil {
+				return err
+			}
+
+			return os.WriteFile(out, content, 0400)
+
+		default:
+			return fmt.Errorf("invalid file in source: %v", path)
+		}
+	})
+}
@@ -6,34 +6,84 @@ package scaffold
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/choria-io/scaffold/internal/sprig"
-	"github.com/kballard/go-shellquote"
 	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"text/template"
+	"text/template/parse"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+	"gopkg.in/yaml.v3"
 )
 
 // Config configures a scaffolding operation
 type Config struct {
 	// TargetDirectory is where to place the resulting rendered files, must not exist
 	TargetDirectory string `yaml:"target"`
-	// SourceDirectory reads templates from a directory, mutually exclusive with Source
+	// SourceDirectory reads templates from a directory, mutually exclusive with Source. Values like scheme://location
+	// are fetched using the SourceResolver registered for the scheme, git repositories like
+	// https://github.com/org/scaffold.git//subdir?ref=v1.2.0 are cloned into SourceCacheDirectory
 	SourceDirectory string `yaml:"source_directory"`
-	// Source reads templates from in-process memory
+	// SourceCacheDirectory is where git repository sources are cloned, defaults to scaffold/git in the user cache directory
+	SourceCacheDirectory string `yaml:"source_cache_directory"`
+	// Source reads templates from in-process memory, values are string, []byte, io.Reader, fs.File (closed once read) or File for files and map[string]any for directories
 	Source map[string]any `yaml:"source"`
 	// Post configures post-processing of files using filepath globs
 	Post []map[string]string `yaml:"post"`
+	// PostRules configures ordered post-processing, run after the rules in Post within the same stage
+	PostRules []PostRule `yaml:"post_rules"`
+	// GitKeep writes an empty .gitkeep file into source directories that are empty after rendering so they survive in git
+	GitKeep bool `yaml:"git_keep"`
 	// SkipEmpty skips files that are 0 bytes after rendering
 	SkipEmpty bool `yaml:"skip_empty"`
 	// Sets a custom template delimiter, useful for generating templates from templates
 	CustomLeftDelimiter string `yaml:"left_delimiter"`
 	// Sets a custom template delimiter, useful for generating templates from templates
 	CustomRightDelimiter string `yaml:"right_delimiter"`
+	// RestrictedFunctions removes template functions that access the environment, OS, network or run commands and limits render to files in the source, useful when rendering untrusted scaffolds
+	RestrictedFunctions bool `yaml:"restricted_functions"`
+	// TargetFS is the filesystem rendered files are written to, defaults to the operating system filesystem
+	TargetFS TargetFS `yaml:"-"`
+	// Fsync flushes rendered files and their directories to disk, only supported with the operating system target filesystem
+	Fsync bool `yaml:"fsync"`
+	// Git commits the rendered files into a new branch of the git repository the target directory is in
+	Git *GitOutput `yaml:"git"`
+	// GitInit initializes a git repository in the target directory with an initial commit of the rendered files
+	GitInit *GitInit `yaml:"git_init"`
+	// NormalizePaths normalizes the unicode form of rendered file names, either NFC or NFD
+	NormalizePaths string `yaml:"normalize_paths"`
+	// WorkingDirectory resolves relative source and target directories and post-processing commands, the process working directory is left unchanged when set
+	WorkingDirectory string `yaml:"working_directory"`
+	// AllowNestedKeys allows Source keys like a/b/file.txt that implicitly create directories
+	AllowNestedKeys bool `yaml:"allow_nested_keys"`
+	// MaxSourceDepth is the deepest directory nesting allowed in Source, defaults to DefaultMaxSourceDepth
+	MaxSourceDepth int `yaml:"max_source_depth"`
+	// MaxSourceFiles is the most files allowed in Source, defaults to DefaultMaxSourceFiles
+	MaxSourceFiles int `yaml:"max_source_files"`
+	// MaxFileSize is the largest file in bytes a template or write may produce, unlimited when 0
+	MaxFileSize int64 `yaml:"max_file_size"`
+	// MaxOutputSize is the most bytes a render may write in total, unlimited when 0
+	MaxOutputSize int64 `yaml:"max_output_size"`
+	// FormatGo formats rendered .go files using gofmt rules, failing the render when they are not valid Go
+	FormatGo bool `yaml:"format_go"`
+	// LicenseHeader adds SPDX license headers to rendered files
+	LicenseHeader *LicenseHeader `yaml:"license_header"`
+	// Overrides change rendering settings for source files matching globs
+	Overrides []FileOverride `yaml:"overrides"`
+	// Trace records the template functions called while rendering each file in the report
+	Trace bool `yaml:"trace"`
+	// SensitiveKeys are dot separated paths to data values that are replaced with *** in logs, reports and errors
+	SensitiveKeys []string `yaml:"sensitive_keys"`
+	// UseManifest reads scaffold.yaml from the root of local and in-memory sources as a Manifest rather than rendering it
+	UseManifest bool `yaml:"use_manifest"`
+	// ReportDataUsage adds warnings to the report for data keys no template references and referenced keys missing from the data
+	ReportDataUsage bool `yaml:"report_data_usage"`
 }
 
 type Logger interface {
@@ -41,14 +91,44 @@ type Logger interface {
 	Infof(format string, v ...any)
 }
 
-var errSkippedEmpty = errors.New("skipped rendering")
+const defaultFileMode fs.FileMode = 0755
+
+// dataFileName is a file in source directories holding data for templates in that directory and below
+const dataFileName = "_data.yaml"
 
 type Scaffold struct {
 	cfg           *Config
 	funcs         template.FuncMap
 	log           Logger
 	workingSource string
+	partials      map[string][]byte
 	currentDir    string
+	currentFile   string
+	report        *RenderReport
+	dynamicPost   []PostRule
+	written       map[string]string
+	sourceMeta    map[string]File
+	noop          bool
+	dataKeys      map[string]bool
+	secrets       []string
+	trace         *[]TraceEntry
+	outputSize    int64
+	// countOutput applies Config.MaxOutputSize, it is only set while render() writes files
+	countOutput bool
+	manifest    *Manifest
+	engine      Engine
+
+	logLevel         LogLevel
+	disabledLogAreas map[LogArea]bool
+}
+
+// absPath resolves p relative to the working directory, or the process working directory when not set
+func (c *Config) absPath(p string) (string, error) {
+	if c.WorkingDirectory != "" && !filepath.IsAbs(p) {
+		return filepath.Join(c.WorkingDirectory, p), nil
+	}
+
+	return filepath.Abs(p)
 }
 
 // New creates a new scaffold instance
@@ -58,32 +138,156 @@ func New(cfg Config, funcs template.FuncMap) (*Scaffold, error) {
 	}
 
 	var err error
-	cfg.TargetDirectory, err = filepath.Abs(cfg.TargetDirectory)
+	if cfg.WorkingDirectory != "" {
+		cfg.WorkingDirectory, err = filepath.Abs(cfg.WorkingDirectory)
+		if err != nil {
+			return nil, fmt.Errorf("invalid working directory %s: %v", cfg.WorkingDirectory, err)
+		}
+	}
+
+	cfg.TargetDirectory, err = cfg.absPath(cfg.TargetDirectory)
 	if err != nil {
 		return nil, fmt.Errorf("invalid target %s: %v", cfg.TargetDirectory, err)
 	}
 
 	if len(cfg.Source) == 0 && cfg.SourceDirectory == "" {
-		return nil, fmt.Errorf("no sources provided")
+		return nil, ErrSourceMissing
+	}
+
+	// streamed entries can only be read once while the source is written out on every render
+	if len(cfg.Source) > 0 {
+		cfg.Source, err = readSourceStreams(cfg.Source, ".", make(map[uintptr]map[string]any))
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if cfg.SourceDirectory != "" {
+	// sources handled by a registered SourceResolver are fetched at render time
+	_, resolved := sourceResolver(&cfg)
+
+	if cfg.SourceDirectory != "" && !resolved {
+		cfg.SourceDirectory, err = cfg.absPath(cfg.SourceDirectory)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source directory %s: %v", cfg.SourceDirectory, err)
+		}
+
 		_, err := os.Stat(cfg.SourceDirectory)
 		if err != nil {
-			return nil, fmt.Errorf("cannot read source directory: %w", err)
+			return nil, fmt.Errorf("%w: cannot read source directory: %w", ErrSourceUnavailable, err)
 		}
 	}
 
-	if _, err := os.Stat(cfg.TargetDirectory); !os.IsNotExist(err) {
-		return nil, fmt.Errorf("target directory exist")
+	// manifests of sources handled by a SourceResolver are not loaded as they are only fetched at render time
+	var manifest *Manifest
+	if cfg.UseManifest && !resolved {
+		manifest, err = cfg.loadManifest()
+		if err != nil {
+			return nil, err
+		}
+		if manifest != nil {
+			cfg.mergeManifest(manifest)
+		}
 	}
 
-	return &Scaffold{cfg: &cfg, funcs: funcs}, nil
+	switch strings.ToUpper(cfg.NormalizePaths) {
+	case "", "NFC", "NFD":
+	default:
+		return nil, fmt.Errorf("invalid path normalization %q, valid values are NFC and NFD", cfg.NormalizePaths)
+	}
+
+	if cfg.TargetFS == nil {
+		cfg.TargetFS = osTargetFS{fsync: cfg.Fsync}
+	} else if cfg.Fsync && !isOSTargetFS(cfg.TargetFS) {
+		return nil, fmt.Errorf("fsync requires the operating system target filesystem")
+	}
+
+	if cfg.LicenseHeader != nil {
+		if cfg.LicenseHeader.SPDX == "" {
+			return nil, fmt.Errorf("license headers require a SPDX identifier")
+		}
+
+		for _, p := range cfg.LicenseHeader.Patterns {
+			err = validateGlob(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid license header pattern %q: %w", p, err)
+			}
+		}
+
+		if cfg.LicenseHeader.License && !hasLicenseText(cfg.LicenseHeader.SPDX) {
+			return nil, fmt.Errorf("no license text available for %s", cfg.LicenseHeader.SPDX)
+		}
+	}
+
+	for _, o := range cfg.Overrides {
+		err = o.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, rule := range cfg.PostRules {
+		err = rule.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if (len(cfg.Post) > 0 || len(cfg.PostRules) > 0) && !isOSTargetFS(cfg.TargetFS) {
+		return nil, fmt.Errorf("post processing requires the operating system target filesystem")
+	}
+
+	if cfg.GitInit != nil {
+		if !isOSTargetFS(cfg.TargetFS) {
+			return nil, fmt.Errorf("git initialization requires the operating system target filesystem")
+		}
+
+		if cfg.Git != nil {
+			return nil, fmt.Errorf("git output and git initialization are mutually exclusive")
+		}
+
+		err = cfg.GitInit.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Git != nil {
+		if !isOSTargetFS(cfg.TargetFS) {
+			return nil, fmt.Errorf("git output requires the operating system target filesystem")
+		}
+
+		err = cfg.Git.validate(cfg.TargetDirectory)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.SourceDirectory != "" && !resolved && isOSTargetFS(cfg.TargetFS) {
+		if isInDirectory(cfg.SourceDirectory, cfg.TargetDirectory) || isInDirectory(cfg.TargetDirectory, cfg.SourceDirectory) {
+			return nil, fmt.Errorf("%w: %s and %s", ErrSourceTargetOverlap, cfg.SourceDirectory, cfg.TargetDirectory)
+		}
+	}
+
+	if _, err := cfg.TargetFS.Stat(cfg.TargetDirectory); !errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrTargetExists
+	}
+
+	return &Scaffold{cfg: &cfg, funcs: funcs, manifest: manifest, logLevel: InfoLevel}, nil
+}
+
+// isInDirectory determines if path is dir or inside it, both must be absolute
+func isInDirectory(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
 }
 
 // RenderString renders a string using the same functions and behavior as the scaffold, including custom delimiters
 func (s *Scaffold) RenderString(str string, data any) (string, error) {
-	res, err := s.renderTemplateBytes("string", []byte(str), data)
+	res, err := s.RenderBytes("string", []byte(str), data)
 	if err != nil {
 		return "", err
 	}
@@ -91,102 +295,300 @@ func (s *Scaffold) RenderString(str string, data any) (string, error) {
 	return string(res), nil
 }
 
-// Logger configures a logger to use, no logging is done without this
-func (s *Scaffold) Logger(log Logger) {
-	s.log = log
+// RenderBytes renders tmpl using the scaffold functions, delimiters and partials, name is used in error messages.
+// When SkipEmpty is set an empty result returns ErrSkippedEmpty
+func (s *Scaffold) RenderBytes(name string, tmpl []byte, data any) ([]byte, error) {
+	defer s.useSecrets(data)()
+
+	res, err := s.renderBytes(name, tmpl, data)
+
+	return res, s.redactError(err)
+}
+
+func (s *Scaffold) renderBytes(name string, tmpl []byte, data any) ([]byte, error) {
+	cleanup, err := s.prepareWorkingSource()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	return s.renderTemplateBytes(name, tmpl, data)
+}
+
+// RenderFile renders the template src into dst using the target filesystem, relative paths are resolved against
+// the working directory. When SkipEmpty is set and the result is empty dst is not written
+func (s *Scaffold) RenderFile(src string, dst string, data any) error {
+	defer s.useSecrets(data)()
+
+	return s.redactError(s.renderFileTo(src, dst, data))
+}
+
+func (s *Scaffold) renderFileTo(src string, dst string, data any) error {
+	src, err := s.cfg.absPath(src)
+	if err != nil {
+		return err
+	}
+
+	dst, err = s.cfg.absPath(dst)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.renderBytes(filepath.Base(src), tmpl, data)
+	switch {
+	case errors.Is(err, ErrSkippedEmpty):
+		s.infof(LogAreaRender, "Skipping empty file %s", dst)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	err = s.cfg.TargetFS.MkdirAll(filepath.Dir(dst), 0775)
+	if err != nil {
+		return err
+	}
+
+	return s.cfg.TargetFS.WriteFile(dst, res, defaultFileMode)
 }
 
-func (s *Scaffold) dumpSourceDir(source map[string]any, target string) error {
-	for k, v := range source {
-		if strings.Contains(k, "..") {
-			return fmt.Errorf("invalid file name %v", k)
+// prepareWorkingSource makes the source available on disk for partials unless it already is, in-memory sources
+// are written to a temporary directory that is removed by the returned cleanup function
+func (s *Scaffold) prepareWorkingSource() (func(), error) {
+	if s.workingSource != "" {
+		return func() {}, nil
+	}
+
+	var err error
+
+	resolver, resolved := sourceResolver(s.cfg)
+
+	switch {
+	case resolved:
+		s.workingSource, err = s.resolveSource(context.Background(), resolver, s.cfg.SourceDirectory)
+
+	case s.cfg.SourceDirectory != "":
+		s.workingSource = s.cfg.SourceDirectory
+		return func() {
+			s.workingSource = ""
+			s.partials = nil
+		}, nil
+
+	default:
+		s.workingSource, err = s.createTempDirForSource()
+	}
+	if err != nil {
+		s.workingSource = ""
+		return nil, err
+	}
+
+	return func() {
+		os.RemoveAll(s.workingSource)
+		s.workingSource = ""
+		s.sourceMeta = nil
+		s.partials = nil
+	}, nil
+}
+
+// partialFiles reads the files in the _partials directory of the working source keyed by their slash separated path
+func (s *Scaffold) partialFiles() (map[string][]byte, error) {
+	if s.partials != nil || s.workingSource == "" {
+		return s.partials, nil
+	}
+
+	s.partials = make(map[string][]byte)
+	dir := filepath.Join(s.workingSource, "_partials")
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
 		}
-		if strings.ContainsAny(k, `/\`) {
-			return fmt.Errorf("invalid file name %v", k)
+
+		if !d.Type().IsRegular() {
+			return nil
 		}
 
-		out := filepath.Join(target, k)
+		rel, err := filepath.Rel(s.workingSource, path)
+		if err != nil {
+			return err
+		}
 
-		switch e := v.(type) {
-		case string: // a file
-			err := os.WriteFile(out, []byte(e), 0400)
-			if err != nil {
-				return err
-			}
+		s.partials[filepath.ToSlash(rel)], err = os.ReadFile(path)
 
-		case map[string]any: // a directory
-			err := os.Mkdir(out, 0700)
-			if err != nil {
-				return err
-			}
+		return err
+	})
+	if err != nil {
+		s.partials = nil
+		return nil, err
+	}
 
-			err = s.dumpSourceDir(e, out)
-			if err != nil {
-				return err
-			}
+	return s.partials, nil
+}
 
-		default: // a mistake
-			return fmt.Errorf("invalid source entry %s: %v", k, v)
+// directoryData merges the _data.yaml file in dir, if any, over data with nested maps merged and other values replaced
+func directoryData(dir string, data any) (any, error) {
+	df, err := os.ReadFile(filepath.Join(dir, dataFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var dd map[string]any
+	err = yaml.Unmarshal(df, &dd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %w", dataFileName, dir, err)
+	}
+
+	if data == nil {
+		data = map[string]any{}
+	}
+
+	dm, ok := data.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s in %s requires map[string]any data, got %T", dataFileName, dir, data)
+	}
+
+	return mergeData(dm, dd), nil
+}
+
+// mergeData returns a copy of dst with src merged over it, dst is not modified
+func mergeData(dst map[string]any, src map[string]any) map[string]any {
+	res := make(map[string]any, len(dst)+len(src))
+	for k, v := range dst {
+		res[k] = v
+	}
+
+	for k, v := range src {
+		sm, sok := v.(map[string]any)
+		dm, dok := res[k].(map[string]any)
+		if sok && dok {
+			res[k] = mergeData(dm, sm)
+		} else {
+			res[k] = v
 		}
 	}
 
-	return nil
+	return res
+}
+
+// Report is a summary of the most recent Render, nil before the first render
+func (s *Scaffold) Report() *RenderReport {
+	return s.report
+}
+
+// Logger configures a logger to use, no logging is done without this
+func (s *Scaffold) Logger(log Logger) {
+	s.log = log
+}
+
+func (s *Scaffold) recordFile(f string, size int, start time.Time, trace []TraceEntry) {
+	if s.report == nil {
+		return
+	}
+
+	s.report.Files = append(s.report.Files, ManagedFile{
+		Path:     s.report.relativePath(f),
+		Action:   FileActionAdd,
+		Size:     int64(size),
+		Duration: time.Since(start),
+		Trace:    trace,
+	})
+}
+
+// recordSkipped records a file that was intentionally not written, empty files are also listed in the report Skipped
+func (s *Scaffold) recordSkipped(f string, reason string) {
+	if s.report == nil {
+		return
+	}
+
+	rel := s.report.relativePath(f)
+	if reason == SkipReasonEmpty {
+		s.report.Skipped = append(s.report.Skipped, rel)
+	}
+
+	s.report.Files = append(s.report.Files, ManagedFile{
+		Path:   rel,
+		Action: FileActionSkipped,
+		Reason: reason,
+	})
 }
 
-func (s *Scaffold) createTempDirForSource() (string, error) {
-	td, err := os.MkdirTemp("", "")
+func (s *Scaffold) saveAndRecordFile(f string, data string) error {
+	start := time.Now()
+
+	content, err := s.formatGo(f, []byte(data))
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	err = s.dumpSourceDir(s.cfg.Source, td)
+	err = s.saveFile(f, content, defaultFileMode)
 	if err != nil {
-		os.RemoveAll(td)
-		return "", err
+		return err
 	}
 
-	return td, nil
+	s.recordFile(f, len(content), start, nil)
+
+	s.infof(LogAreaRender, "Rendered %s", f)
+
+	return nil
 }
 
-func (s *Scaffold) saveAndPostFile(f string, data string) error {
-	err := s.saveFile(f, data)
+// mkdirAndRecord creates dir and its parents inside the target directory
+func (s *Scaffold) mkdirAndRecord(dir string) error {
+	abs, err := s.targetFile(dir)
 	if err != nil {
 		return err
 	}
 
-	err = s.postFile(f)
+	err = s.cfg.TargetFS.MkdirAll(abs, 0775)
 	if err != nil {
 		return err
 	}
 
-	if s.log != nil {
-		s.log.Infof("Rendered %s", f)
+	if s.report != nil {
+		s.report.Directories = append(s.report.Directories, s.report.relativePath(dir))
 	}
 
+	s.infof(LogAreaRender, "Created directory %s", dir)
+
 	return nil
 }
 
-func (s *Scaffold) renderAndPostFile(out string, t string, data any) error {
-	err := s.renderFile(out, t, data)
+func (s *Scaffold) renderAndRecordFile(out string, t string, data any) error {
+	start := time.Now()
+
+	s.debugf(LogAreaRender, "Rendering %s into %s", t, out)
+
+	var trace []TraceEntry
+	if s.cfg.Trace {
+		s.trace = &trace
+		defer func() { s.trace = nil }()
+	}
+
+	size, err := s.renderFile(out, t, data)
 	switch {
-	case errors.Is(err, errSkippedEmpty):
-		if s.log != nil {
-			s.log.Infof("Skipping empty file %v", out)
-		}
+	case errors.Is(err, ErrSkippedEmpty):
+		s.recordSkipped(out, SkipReasonEmpty)
+
+		s.infof(LogAreaRender, "Skipping empty file %v", out)
 
 		return nil
 	case err != nil:
 		return err
 	}
 
-	err = s.postFile(out)
-	if err != nil {
-		return err
-	}
+	s.recordFile(out, size, start, trace)
 
-	if s.log != nil {
-		s.log.Infof("Rendered %s", out)
-	}
+	s.infof(LogAreaRender, "Rendered %s", out)
 
 	return nil
 }
@@ -196,24 +598,114 @@ func (s *Scaffold) templateFuncs() template.FuncMap {
 		return nil
 	}
 
-	funcs := sprig.FuncMap()
+	var funcs template.FuncMap
+	if s.cfg.RestrictedFunctions {
+		funcs = sprig.RestrictedTxtFuncMap()
+	} else {
+		funcs = sprig.TxtFuncMap()
+	}
+
 	for k, v := range s.funcs {
 		funcs[k] = v
 	}
 
 	funcs["write"] = func(out string, content string) (string, error) {
-		err := s.saveAndPostFile(filepath.Join(s.cfg.TargetDirectory, out), content)
+		err := s.saveAndRecordFile(s.targetPath(out), content)
 		return "", err
 	}
 
+	funcs["mkdir"] = func(dir string) (string, error) {
+		return "", s.mkdirAndRecord(s.targetPath(dir))
+	}
+
+	// addPost runs commands so untrusted templates may not use it
+	if !s.cfg.RestrictedFunctions {
+		funcs["addPost"] = func(glob string, command string) (string, error) {
+			if !s.noop && !isOSTargetFS(s.cfg.TargetFS) {
+				return "", fmt.Errorf("post processing requires the operating system target filesystem")
+			}
+
+			if command == "" {
+				return "", fmt.Errorf("post processing rules require a command")
+			}
+
+			s.dynamicPost = append(s.dynamicPost, PostRule{Pattern: glob, Command: command})
+
+			return "", nil
+		}
+	}
+
+	funcs["readTarget"] = func(f string) (string, error) {
+		abs, err := s.targetFile(s.targetPath(f))
+		if err != nil {
+			return "", err
+		}
+
+		content, err := s.cfg.TargetFS.ReadFile(abs)
+		return string(content), err
+	}
+
+	// these emit literal Go template delimiters, useful when generating GitHub Actions, Helm charts or other templates
+	funcs["leftDelim"] = func() string { return "{{" }
+	funcs["rightDelim"] = func() string { return "}}" }
+
+	funcs["goIdent"] = goIdent
+	funcs["goModulePath"] = goModulePath
+	funcs["goVersion"] = goVersion
+
+	funcs["licenseHeader"] = func(spdx string, copyright string) string {
+		return licenseHeader(s.currentFile, spdx, copyright)
+	}
+
+	if !s.cfg.RestrictedFunctions {
+		s.gitTemplateFuncs(funcs)
+	}
+
 	funcs["render"] = func(templ string, data any) (string, error) {
-		res, err := s.renderTemplateFile(filepath.Join(s.workingSource, templ), data)
+		file, err := s.sourceFile(templ)
+		if err != nil {
+			return "", err
+		}
+
+		res, err := s.renderTemplateFile(file, data)
 		return string(res), err
 	}
 
+	if s.cfg.Trace {
+		s.traceFuncs(funcs)
+	}
+
 	return funcs
 }
 
+// sourceFile is the path to templ in the source, restricted templates may not reach files outside the source
+func (s *Scaffold) sourceFile(templ string) (string, error) {
+	file := filepath.Join(s.workingSource, templ)
+	if !s.cfg.RestrictedFunctions {
+		return file, nil
+	}
+
+	if s.workingSource == "" {
+		return "", fmt.Errorf("%w: %s is not in the source", ErrPathEscape, templ)
+	}
+
+	dir, err := resolveSymlinks(s.workingSource)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := resolveSymlinks(file)
+	if err != nil {
+		return "", err
+	}
+
+	if !isInDirectory(dir, resolved) {
+		return "", fmt.Errorf("%w: %s is not in the source", ErrPathEscape, templ)
+	}
+
+	return file, nil
+}
+
 func (s *Scaffold) renderTemplateFile(tmpl string, data any) ([]byte, error) {
 	td, err := os.ReadFile(tmpl)
 	if err != nil {
@@ -224,91 +716,182 @@ func (s *Scaffold) renderTemplateFile(tmpl string, data any) ([]byte, error) {
 }
 
 func (s *Scaffold) renderTemplateBytes(name string, tmpl []byte, data any) ([]byte, error) {
-	buf := bytes.NewBuffer([]byte{})
+	if s.engine != nil {
+		return s.renderWithEngine(name, tmpl, data)
+	}
+
+	buf := &sizeLimitWriter{s: s, name: name}
 	templ := template.New(name)
 	funcs := s.templateFuncs()
 	if funcs != nil {
 		templ.Funcs(funcs)
 	}
 
-	if s.cfg.CustomLeftDelimiter != "" && s.cfg.CustomRightDelimiter != "" {
-		templ.Delims(s.cfg.CustomLeftDelimiter, s.cfg.CustomRightDelimiter)
+	settings := s.renderSettings(s.currentFile)
+	if settings.leftDelimiter != "" {
+		templ.Delims(settings.leftDelimiter, settings.rightDelimiter)
 	}
 
 	templ, err := templ.Parse(string(tmpl))
 	if err != nil {
-		return nil, fmt.Errorf("parsing template %v failed: %w", tmpl, err)
+		if hint := s.suggestion(err, data); hint != "" {
+			return nil, fmt.Errorf("%w: %s: %w, %s", ErrTemplateParse, name, err, hint)
+		}
+		return nil, fmt.Errorf("%w: %s: %w", ErrTemplateParse, name, err)
+	}
+
+	// partials can be used with the template action by their path like _partials/header.txt
+	partials, err := s.partialFiles()
+	if err != nil {
+		return nil, err
+	}
+	for pname, pbody := range partials {
+		if templ.Lookup(pname) != nil {
+			continue
+		}
+
+		_, err = templ.New(pname).Parse(string(pbody))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrTemplateParse, pname, err)
+		}
+	}
+
+	var trees []*parse.Tree
+	for _, t := range templ.Templates() {
+		trees = append(trees, t.Tree)
 	}
+	s.recordDataKeys(trees)
+	s.tracePartials(templ)
 
 	err = templ.Execute(buf, data)
 	if err != nil {
+		if hint := s.suggestion(err, data); hint != "" {
+			return nil, fmt.Errorf("%w, %s", err, hint)
+		}
 		return nil, err
 	}
 
-	if s.cfg.SkipEmpty && len(bytes.TrimSpace(buf.Bytes())) == 0 {
-		return nil, errSkippedEmpty
+	if settings.skipEmpty && len(bytes.TrimSpace(buf.buf)) == 0 {
+		return nil, ErrSkippedEmpty
 	}
 
-	return buf.Bytes(), nil
+	return buf.buf, nil
 }
 
-func (s *Scaffold) saveFile(out string, content string) error {
-	absOut, err := filepath.Abs(out)
+// targetFile resolves f to an absolute path and ensures it is inside the target directory
+func (s *Scaffold) targetFile(f string) (string, error) {
+	abs, err := filepath.Abs(f)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	if !strings.HasPrefix(absOut, s.cfg.TargetDirectory) {
-		return fmt.Errorf("%s is not in target directory %s", out, s.cfg.TargetDirectory)
+	dir, resolved := s.cfg.TargetDirectory, abs
+
+	// on the operating system compare real paths so symlinked targets are allowed and symlinks out of the target are not
+	if isOSTargetFS(s.cfg.TargetFS) {
+		dir, err = resolveSymlinks(dir)
+		if err != nil {
+			return "", err
+		}
+
+		resolved, err = resolveSymlinks(abs)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !isInDirectory(dir, resolved) {
+		return "", fmt.Errorf("%w: %s is not in %s", ErrPathEscape, f, s.cfg.TargetDirectory)
 	}
 
-	return os.WriteFile(out, []byte(content), 0755)
+	return abs, nil
+}
+
+// resolveSymlinks evaluates symlinks in the longest existing prefix of the absolute path p
+func resolveSymlinks(p string) (string, error) {
+	var rest []string
+
+	for {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(p)
+		if parent == p {
+			return filepath.Join(append([]string{p}, rest...)...), nil
+		}
+
+		rest = append([]string{filepath.Base(p)}, rest...)
+		p = parent
+	}
 }
 
-func (s *Scaffold) renderFile(out string, t string, data any) error {
-	res, err := s.renderTemplateFile(t, data)
+func (s *Scaffold) saveFile(out string, content []byte, mode fs.FileMode) error {
+	absOut, err := s.targetFile(out)
 	if err != nil {
 		return err
 	}
 
-	return s.saveFile(out, string(res))
-}
+	err = s.checkCaseCollision(absOut)
+	if err != nil {
+		return err
+	}
 
-func (s *Scaffold) postFile(f string) error {
-	for _, p := range s.cfg.Post {
-		for g, v := range p {
-			matched, err := filepath.Match(g, filepath.Base(f))
-			if err != nil {
-				return err
-			}
+	err = s.checkSize(out, int64(len(content)))
+	if err != nil {
+		return err
+	}
 
-			if !matched {
-				continue
-			}
+	err = s.cfg.TargetFS.WriteFile(out, content, mode)
+	if err != nil {
+		return err
+	}
 
-			cmd := ""
-			var args []string
+	if s.countOutput {
+		s.outputSize += int64(len(content))
+	}
 
-			parts, err := shellquote.Split(strings.ReplaceAll(v, "{}", f))
-			if err != nil {
-				return err
-			}
-			cmd = parts[0]
-			if len(parts) > 1 {
-				args = append(args, parts[1:]...)
-			}
+	return nil
+}
 
-			if !strings.Contains(v, "{}") {
-				args = append(args, f)
-			}
+// targetPath joins rel to the target directory applying any configured unicode normalization to rel
+func (s *Scaffold) targetPath(rel string) string {
+	switch strings.ToUpper(s.cfg.NormalizePaths) {
+	case "NFC":
+		rel = norm.NFC.String(rel)
+	case "NFD":
+		rel = norm.NFD.String(rel)
+	}
 
-			if s.log != nil {
-				s.log.Infof("Post processing using: %s %s", cmd, strings.Join(args, " "))
+	return filepath.Join(s.cfg.TargetDirectory, rel)
+}
+
+// keepEmptyDirectories writes a .gitkeep file into every directory in dirs that has no files after rendering,
+// dirs are in walk order so they are visited in reverse to handle nested empty directories first
+func (s *Scaffold) keepEmptyDirectories(dirs []string) error {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		keep, err := s.targetFile(filepath.Join(dirs[i], ".gitkeep"))
+		if err != nil {
+			return err
+		}
+
+		prefix := filepath.Dir(keep) + string(filepath.Separator)
+		empty := true
+		for _, f := range s.written {
+			if strings.HasPrefix(f, prefix) {
+				empty = false
+				break
 			}
+		}
 
-			out, err := exec.Command(cmd, args...).CombinedOutput()
+		if empty {
+			err = s.saveAndRecordFile(filepath.Join(dirs[i], ".gitkeep"), "")
 			if err != nil {
-				return fmt.Errorf("failed to post process %s\nerror: %w\noutput: %q", f, err, out)
+				return err
 			}
 		}
 	}
@@ -316,40 +899,171 @@ func (s *Scaffold) postFile(f string) error {
 	return nil
 }
 
-// Render creates the target directory and place all files into it after template processing and post-processing
-func (s *Scaffold) Render(data any) error {
-	err := os.MkdirAll(s.cfg.TargetDirectory, 0770)
+// checkCaseCollision ensures that files written during a render do not differ only by case, on case-insensitive
+// filesystems the later file would silently replace the earlier one
+func (s *Scaffold) checkCaseCollision(f string) error {
+	if s.written == nil {
+		return nil
+	}
+
+	key := strings.ToLower(f)
+	prev, ok := s.written[key]
+	if ok && prev != f {
+		return fmt.Errorf("%w: %s and %s differ only by case", ErrCaseCollision, prev, f)
+	}
+
+	s.written[key] = f
+
+	return nil
+}
+
+// renderFile renders t into out returning the number of bytes written
+func (s *Scaffold) renderFile(out string, t string, data any) (int, error) {
+	var res []byte
+	var err error
+
+	meta := s.sourceMeta[t]
+	if meta.Raw || s.renderSettings(s.currentFile).raw {
+		res, err = os.ReadFile(t)
+	} else {
+		res, err = s.renderTemplateFile(t, data)
+		if err == nil {
+			res, err = s.formatGo(out, s.addLicenseHeader(s.currentFile, res))
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	mode := meta.Mode
+	if mode == 0 {
+		mode = defaultFileMode
+	}
+
+	return len(res), s.saveFile(out, res, mode)
+}
+
+// RenderNoop renders into memory leaving the target untouched, post-processing commands that would run are listed
+// in the report without being executed and no git commit is made
+func (s *Scaffold) RenderNoop(data any, opts ...RenderOption) (*RenderReport, error) {
+	err := s.renderMemory(NewMemoryTargetFS(), data, opts...)
+
+	return s.report, err
+}
+
+// RenderToMap renders into memory returning the rendered files keyed by their slash separated path relative to the
+// target directory, like RenderNoop the target is untouched and post-processing and git are skipped
+func (s *Scaffold) RenderToMap(data any, opts ...RenderOption) (map[string][]byte, error) {
+	mfs := NewMemoryTargetFS()
+
+	err := s.renderMemory(mfs, data, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string][]byte)
+	for _, f := range mfs.Files() {
+		content, err := mfs.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		res[s.report.relativePath(f)] = content
+	}
+
+	return res, nil
+}
+
+// renderMemory renders into mfs in noop mode
+func (s *Scaffold) renderMemory(mfs *MemoryTargetFS, data any, opts ...RenderOption) error {
+	target := s.cfg.TargetFS
+	s.cfg.TargetFS = mfs
+	s.noop = true
+	defer func() {
+		s.cfg.TargetFS = target
+		s.noop = false
+	}()
+
+	return s.Render(data, opts...)
+}
+
+// Render creates the target directory and place all files into it after template processing and post-processing,
+// use WithOnly to render a subset of the files
+func (s *Scaffold) Render(data any, opts ...RenderOption) error {
+	defer s.useSecrets(data)()
+
+	err := s.render(data, opts...)
+	s.redactReport(s.report)
+
+	return s.redactError(err)
+}
+
+func (s *Scaffold) render(data any, opts ...RenderOption) error {
+	ropts, err := newRenderOptions(opts...)
 	if err != nil {
 		return err
 	}
 
-	cwd, err := os.Getwd()
+	err = s.checkRequired(data)
 	if err != nil {
 		return err
 	}
 
-	err = os.Chdir(s.cfg.TargetDirectory)
+	s.report = newRenderReport(s.cfg.TargetDirectory)
+	s.report.Noop = s.noop
+	defer func() { s.report.Duration = time.Since(s.report.Started) }()
+
+	s.dynamicPost = nil
+	s.outputSize = 0
+	s.countOutput = true
+	s.written = make(map[string]string)
+	defer func() {
+		s.dynamicPost = nil
+		s.written = nil
+		s.countOutput = false
+	}()
+
+	err = s.cfg.TargetFS.MkdirAll(s.cfg.TargetDirectory, 0770)
 	if err != nil {
 		return err
 	}
-	defer os.Chdir(cwd)
 
-	s.workingSource = s.cfg.SourceDirectory
+	// with a working directory set the process directory is not changed, post processing still runs in the target
+	if isOSTargetFS(s.cfg.TargetFS) && s.cfg.WorkingDirectory == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
 
-	if s.workingSource == "" {
-		// move the memory source to temp dir
-		s.workingSource, err = s.createTempDirForSource()
+		err = os.Chdir(s.cfg.TargetDirectory)
 		if err != nil {
 			return err
 		}
-		defer func() {
-			os.RemoveAll(s.workingSource)
-			s.workingSource = ""
-		}()
+		defer os.Chdir(cwd)
 	}
 
+	s.workingSource = ""
+	cleanup, err := s.prepareWorkingSource()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
 	s.currentDir = s.cfg.TargetDirectory
-	defer func() { s.currentDir = "" }()
+	defer func() {
+		s.currentDir = ""
+		s.currentFile = ""
+	}()
+
+	if s.cfg.ReportDataUsage {
+		s.dataKeys = make(map[string]bool)
+		defer func() { s.dataKeys = nil }()
+	}
+
+	// data for each directory with its _data.yaml merged over that of its parent
+	dirData := map[string]any{}
+	// directories created in the target in the order they were walked
+	var dirs []string
 
 	// now render both the same way
 	err = filepath.WalkDir(s.workingSource, func(path string, d fs.DirEntry, err error) error {
@@ -358,24 +1072,62 @@ func (s *Scaffold) Render(data any) error {
 		}
 
 		if path == s.workingSource {
-			return nil
+			dirData[path], err = directoryData(path, data)
+			return err
 		}
 
 		if d.Name() == "_partials" {
 			return filepath.SkipDir
 		}
 
-		out := filepath.Join(s.cfg.TargetDirectory, strings.TrimPrefix(path, s.workingSource))
+		if d.Name() == dataFileName {
+			return nil
+		}
+
+		if s.manifest != nil && path == filepath.Join(s.workingSource, manifestFileName) {
+			return nil
+		}
+
+		out := s.targetPath(strings.TrimPrefix(path, s.workingSource))
 		switch {
 		case d.IsDir():
-			err := os.Mkdir(out, 0775)
+			dirData[path], err = directoryData(path, dirData[filepath.Dir(path)])
+			if err != nil {
+				return err
+			}
+
+			// with only some files selected directories are made as needed for those files
+			if len(ropts.only) > 0 {
+				return nil
+			}
+
+			err := s.cfg.TargetFS.MkdirAll(out, 0775)
 			if err != nil {
 				return err
 			}
+			dirs = append(dirs, out)
 
 		case d.Type().IsRegular():
+			rel, err := filepath.Rel(s.workingSource, path)
+			if err != nil {
+				return err
+			}
+
+			if !ropts.selected(filepath.ToSlash(rel)) {
+				s.recordSkipped(out, SkipReasonNotSelected)
+				return nil
+			}
+
+			if len(ropts.only) > 0 {
+				err = s.cfg.TargetFS.MkdirAll(filepath.Dir(out), 0775)
+				if err != nil {
+					return err
+				}
+			}
+
 			s.currentDir = filepath.Dir(out)
-			err = s.renderAndPostFile(out, path, data)
+			s.currentFile = filepath.ToSlash(rel)
+			err = s.renderAndRecordFile(out, path, dirData[filepath.Dir(path)])
 			if err != nil {
 				return err
 			}
@@ -390,5 +1142,58 @@ func (s *Scaffold) Render(data any) error {
 		return err
 	}
 
+	// with only some files selected the LICENSE file is not part of the render
+	if s.cfg.LicenseHeader != nil && s.cfg.LicenseHeader.License && len(ropts.only) == 0 {
+		err = s.writeLicense()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.cfg.GitKeep {
+		err = s.keepEmptyDirectories(dirs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.cfg.ReportDataUsage {
+		provided := map[string]bool{}
+		for _, dd := range dirData {
+			if dm, ok := dd.(map[string]any); ok {
+				for k := range dm {
+					provided[k] = true
+				}
+			}
+		}
+
+		for _, w := range dataUsageWarnings(data, provided, s.dataKeys) {
+			s.report.Warnings = append(s.report.Warnings, w)
+			s.warnf(LogAreaRender, "%s", w)
+		}
+	}
+
+	err = s.postProcess()
+	if err != nil {
+		return err
+	}
+
+	// commit messages are not part of the output
+	s.countOutput = false
+
+	if s.cfg.Git != nil && !s.noop {
+		err = s.commitToGit(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.cfg.GitInit != nil && !s.noop {
+		err = s.initGit(data)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
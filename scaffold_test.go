@@ -0,0 +1,1777 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"unicode/utf8"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type testResolver struct {
+	specs   []string
+	cleaned int
+}
+
+func (r *testResolver) Resolve(_ context.Context, spec string) (fs.FS, Cleanup, error) {
+	r.specs = append(r.specs, spec)
+
+	source := fstest.MapFS{
+		"hello.txt":         {Data: []byte("hello {{ .name }}")},
+		"sub/sub.txt":       {Data: []byte("{{ .name | upper }}")},
+		"_partials/p.txt":   {Data: []byte("partial")},
+		"sub/_data.yaml":    {Data: []byte("extra: x\n")},
+		"sub/with_data.txt": {Data: []byte("{{ .extra }}")},
+	}
+
+	return source, func() error { r.cleaned++; return nil }, nil
+}
+
+// testEngine replaces %name% with the name data item
+type testEngine struct{}
+
+func (testEngine) Render(name string, tmpl []byte, data any) ([]byte, error) {
+	if bytes.Contains(tmpl, []byte("%fail%")) {
+		return nil, fmt.Errorf("cannot render %s", name)
+	}
+
+	return bytes.ReplaceAll(tmpl, []byte("%name%"), []byte(fmt.Sprint(data.(map[string]any)["name"]))), nil
+}
+
+func TestScaffold(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Scaffold")
+}
+
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Debugf(format string, v ...any) {
+	l.lines = append(l.lines, "debug: "+fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) Infof(format string, v ...any) {
+	l.lines = append(l.lines, "info: "+fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) Warnf(format string, v ...any) {
+	l.lines = append(l.lines, "warn: "+fmt.Sprintf(format, v...))
+}
+
+var _ = Describe("Scaffold", func() {
+	var td string
+
+	BeforeEach(func() {
+		td = GinkgoT().TempDir()
+	})
+
+	Describe("Render", func() {
+		It("Should render memory sources", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source: map[string]any{
+					"hello.txt": `hello {{ .name }}`,
+					"sub": map[string]any{
+						"sub.txt": `{{ .name | upper }}`,
+					},
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "hello.txt"))).To(Equal([]byte("hello world")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "sub", "sub.txt"))).To(Equal([]byte("WORLD")))
+		})
+	})
+
+	Describe("WithOnly", func() {
+		It("Should render only matching files", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source: map[string]any{
+					"Dockerfile": "FROM {{ .image }}",
+					"README.md":  "readme",
+					"helm": map[string]any{
+						"values.yaml": "image: {{ .image }}",
+						"templates":   map[string]any{"deploy.yaml": "deploy"},
+					},
+					"docs": map[string]any{"index.md": "docs"},
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.Render(map[string]any{"image": "alpine"}, WithOnly("helm/**", "Dockerfile"))).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "Dockerfile"))).To(Equal([]byte("FROM alpine")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "helm", "values.yaml"))).To(Equal([]byte("image: alpine")))
+			Expect(filepath.Join(td, "target", "helm", "templates", "deploy.yaml")).To(BeARegularFile())
+			Expect(filepath.Join(td, "target", "README.md")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(td, "target", "docs")).ToNot(BeAnExistingFile())
+			Expect(s.Report().Stats().Added).To(Equal(3))
+			Expect(s.Report().Files).To(ContainElement(ManagedFile{Path: "README.md", Action: FileActionSkipped, Reason: SkipReasonNotSelected}))
+			Expect(s.Report().Skipped).To(BeEmpty())
+
+			Expect(s.Render(nil, WithOnly("["))).To(MatchError(ContainSubstring("invalid glob")))
+		})
+
+		DescribeTable("Glob matching",
+			func(pattern string, name string, expected bool) {
+				Expect(matchGlob(pattern, name)).To(Equal(expected))
+			},
+			Entry("exact", "Dockerfile", "Dockerfile", true),
+			Entry("not nested", "Dockerfile", "sub/Dockerfile", false),
+			Entry("star", "helm/*.yaml", "helm/values.yaml", true),
+			Entry("star does not cross directories", "helm/*.yaml", "helm/templates/x.yaml", false),
+			Entry("double star", "helm/**", "helm/templates/x.yaml", true),
+			Entry("double star in the middle", "helm/**/x.yaml", "helm/x.yaml", true),
+			Entry("leading double star", "**/*.md", "docs/a/index.md", true),
+			Entry("other directory", "helm/**", "docs/index.md", false),
+		)
+	})
+
+	Describe("Overrides", func() {
+		It("Should apply per file settings", func() {
+			keep := false
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				SkipEmpty:       true,
+				Overrides: []FileOverride{
+					{Pattern: "scripts/*.sh", LeftDelimiter: "[[", RightDelimiter: "]]"},
+					{Pattern: "literal/**", Raw: true},
+					{Pattern: "keep.txt", SkipEmpty: &keep},
+				},
+				Source: map[string]any{
+					"a.txt":    "{{ .name }}",
+					"empty":    "",
+					"keep.txt": "",
+					"scripts":  map[string]any{"run.sh": `echo ${{ "{" }}HOME} [[ .name ]]`},
+					"literal":  map[string]any{"sub": map[string]any{"x.tmpl": "{{ .name }}"}},
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "a.txt"))).To(Equal([]byte("world")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "scripts", "run.sh"))).To(Equal([]byte(`echo ${{ "{" }}HOME} world`)))
+			Expect(os.ReadFile(filepath.Join(td, "target", "literal", "sub", "x.tmpl"))).To(Equal([]byte("{{ .name }}")))
+			Expect(filepath.Join(td, "target", "keep.txt")).To(BeARegularFile())
+			Expect(filepath.Join(td, "target", "empty")).ToNot(BeAnExistingFile())
+		})
+
+		It("Should validate overrides", func() {
+			_, err := New(Config{TargetDirectory: "/target", Source: map[string]any{"x": "x"}, Overrides: []FileOverride{{Pattern: "*", LeftDelimiter: "[["}}}, nil)
+			Expect(err).To(MatchError(ContainSubstring("requires both delimiters")))
+
+			_, err = New(Config{TargetDirectory: "/target", Source: map[string]any{"x": "x"}, Overrides: []FileOverride{{Raw: true}}}, nil)
+			Expect(err).To(MatchError(ContainSubstring("require a pattern")))
+		})
+	})
+
+	Describe("ReportDataUsage", func() {
+		It("Should warn about unused and missing data keys", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				ReportDataUsage: true,
+				Source: map[string]any{
+					"_data.yaml": "port: 80\n",
+					"a.txt":      `{{ .ProjectNmae }} {{ .port }}{{ range .items }}{{ .name }}{{ $.owner }}{{ end }}`,
+					"b.txt":      `{{ with .nested }}{{ .inner }}{{ end }}`,
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.Render(map[string]any{"ProjectName": "x", "items": []any{}, "owner": "o", "nested": nil})).To(Succeed())
+			Expect(s.Report().Warnings).To(Equal([]string{
+				`data key "ProjectName" is not used by any template`,
+				`templates reference missing data key "ProjectNmae"`,
+			}))
+		})
+	})
+
+	Describe("SourceResolver", func() {
+		It("Should render sources from registered resolvers", func() {
+			resolver := &testResolver{}
+			Expect(RegisterSourceResolver("memtest", resolver)).To(Succeed())
+			Expect(RegisterSourceResolver("memtest", resolver)).To(MatchError(ContainSubstring("already registered")))
+
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), SourceDirectory: "memtest://bucket/path"}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+
+			Expect(resolver.specs).To(Equal([]string{"memtest://bucket/path"}))
+			Expect(resolver.cleaned).To(Equal(1))
+			Expect(os.ReadFile(filepath.Join(td, "target", "hello.txt"))).To(Equal([]byte("hello world")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "sub", "sub.txt"))).To(Equal([]byte("WORLD")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "sub", "with_data.txt"))).To(Equal([]byte("x")))
+			Expect(filepath.Join(td, "target", "_partials")).ToNot(BeAnExistingFile())
+
+			_, err = New(Config{TargetDirectory: filepath.Join(td, "other"), SourceDirectory: "unknown://x"}, map[string]any{})
+			Expect(err).To(MatchError(ErrSourceUnavailable))
+		})
+
+		It("Should render git repository sources", func() {
+			for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+				GinkgoT().Setenv(k, "test")
+			}
+			for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+				GinkgoT().Setenv(k, "test@example.net")
+			}
+
+			work := filepath.Join(td, "work")
+			Expect(os.MkdirAll(filepath.Join(work, "templates"), 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(work, "templates", "hello.txt"), []byte("v1 {{ .name }}"), 0600)).To(Succeed())
+			_, err := git(work, "init", "-q")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = git(work, "add", ".")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = git(work, "commit", "-q", "-m", "v1")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = git(work, "tag", "v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(work, "templates", "hello.txt"), []byte("v2 {{ .name }}"), 0600)).To(Succeed())
+			_, err = git(work, "commit", "-q", "-a", "-m", "v2")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = git(td, "clone", "-q", "--bare", work, filepath.Join(td, "repo.git"))
+			Expect(err).ToNot(HaveOccurred())
+
+			for ref, expected := range map[string]string{"?ref=v1": "v1 world", "": "v2 world"} {
+				target := filepath.Join(td, "target"+ref)
+				s, err := New(Config{
+					TargetDirectory:      target,
+					SourceDirectory:      "file://" + filepath.Join(td, "repo.git") + "//templates" + ref,
+					SourceCacheDirectory: filepath.Join(td, "cache"),
+				}, map[string]any{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+				Expect(os.ReadFile(filepath.Join(target, "hello.txt"))).To(Equal([]byte(expected)))
+				Expect(filepath.Join(target, ".git")).ToNot(BeAnExistingFile())
+			}
+		})
+
+		DescribeTable("Git source parsing",
+			func(spec string, repo string, subdir string, ref string) {
+				src, ok := parseGitSource(spec)
+				if repo == "" {
+					Expect(ok).To(BeFalse())
+					return
+				}
+				Expect(ok).To(BeTrue())
+				Expect(*src).To(Equal(gitSource{repo: repo, subdir: subdir, ref: ref}))
+			},
+			Entry("https", "https://github.com/org/scaffold.git//subdir?ref=v1.2.0", "https://github.com/org/scaffold.git", "subdir", "v1.2.0"),
+			Entry("no subdir", "https://github.com/org/scaffold.git", "https://github.com/org/scaffold.git", "", ""),
+			Entry("scp", "git@github.com:org/scaffold.git//a/b", "git@github.com:org/scaffold.git", "a/b", ""),
+			Entry("not git", "https://example.net/templates", "", "", ""),
+			Entry("local directory", "/srv/templates.git", "", "", ""),
+			Entry("option repo", "--upload-pack=touch pwned;@x.git", "", "", ""),
+			Entry("option ref", "https://github.com/org/scaffold.git?ref=--output=/tmp/x", "", "", ""),
+			Entry("option subdir", "https://github.com/org/scaffold.git//--output=x", "", "", ""),
+		)
+
+		It("Should not pass source values to git as options", func() {
+			_, _, err := (&GitSourceResolver{CacheDirectory: filepath.Join(td, "cache")}).Resolve(context.Background(), "--upload-pack=touch pwned;@x.git")
+			Expect(err).To(MatchError(ContainSubstring("invalid git source")))
+			Expect(filepath.Join(td, "cache")).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Describe("Engine", func() {
+		It("Should render using the custom engine", func() {
+			_, err := NewWithEngine(Config{TargetDirectory: filepath.Join(td, "target"), Source: map[string]any{"x": "x"}}, nil)
+			Expect(err).To(MatchError("template engine is required"))
+
+			s, err := NewWithEngine(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				SkipEmpty:       true,
+				Source:          map[string]any{"hello.txt": "hello %name% {{ .name }}", "empty.txt": " "},
+			}, testEngine{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "hello.txt"))).To(Equal([]byte("hello world {{ .name }}")))
+			Expect(filepath.Join(td, "target", "empty.txt")).ToNot(BeAnExistingFile())
+
+			_, err = s.RenderString("%fail%", nil)
+			Expect(err).To(MatchError(ContainSubstring("cannot render")))
+		})
+	})
+
+	Describe("Manifest", func() {
+		It("Should load and apply scaffold.yaml", func() {
+			out := filepath.Join(td, "post")
+			source := map[string]any{
+				"scaffold.yaml": `
+name: service
+version: 1.0.0
+description: A service
+required: [name, port]
+left_delimiter: "[["
+right_delimiter: "]]"
+post_rules:
+  - pattern: "*.txt"
+    command: "sh -c 'echo {} > ` + out + `'"
+`,
+				"hello.txt": "[[ .name ]] {{ x }}",
+			}
+
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: source, UseManifest: true}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Manifest().Name).To(Equal("service"))
+			Expect(s.Manifest().Description).To(Equal("A service"))
+
+			Expect(s.Render(map[string]any{"name": "world"})).To(MatchError(ErrRequiredData))
+			Expect(s.Render(map[string]any{"name": "world"})).To(MatchError(HaveSuffix(": port")))
+
+			Expect(s.Render(map[string]any{"name": "world", "port": 80})).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "hello.txt"))).To(Equal([]byte("world {{ x }}")))
+			Expect(filepath.Join(td, "target", "scaffold.yaml")).ToNot(BeAnExistingFile())
+			Expect(out).To(BeARegularFile())
+		})
+
+		It("Should reject invalid manifests", func() {
+			_, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: map[string]any{"scaffold.yaml": "nmae: x"}, UseManifest: true}, map[string]any{})
+			Expect(err).To(MatchError(ContainSubstring("invalid scaffold.yaml")))
+		})
+
+		It("Should render scaffold.yaml unless enabled", func() {
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: map[string]any{"scaffold.yaml": "name: {{ .name }}"}}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Manifest()).To(BeNil())
+
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "scaffold.yaml"))).To(Equal([]byte("name: world")))
+		})
+
+		It("Should merge overrides with the configured ones", func() {
+			source := map[string]any{
+				"scaffold.yaml": `
+overrides:
+  - pattern: "*.sh"
+    left_delimiter: "[["
+    right_delimiter: "]]"
+  - pattern: "raw.*"
+    raw: true
+`,
+				"run.sh":   `echo {{ x }} [[ .name ]]`,
+				"build.sh": `echo {{ x }} [[ x ]] <% .name %>`,
+				"raw.txt":  `{{ .name }}`,
+			}
+
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          source,
+				UseManifest:     true,
+				Overrides:       []FileOverride{{Pattern: "build.sh", LeftDelimiter: "<%", RightDelimiter: "%>"}},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "run.sh"))).To(Equal([]byte("echo {{ x }} world")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "build.sh"))).To(Equal([]byte("echo {{ x }} [[ x ]] world")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "raw.txt"))).To(Equal([]byte("{{ .name }}")))
+
+			_, err = New(Config{
+				TargetDirectory: filepath.Join(td, "target2"),
+				Source:          map[string]any{"scaffold.yaml": "overrides:\n  - raw: true\n"},
+				UseManifest:     true,
+			}, map[string]any{})
+			Expect(err).To(MatchError("file overrides require a pattern"))
+		})
+
+		It("Should ignore post rules in restricted mode", func() {
+			out := filepath.Join(td, "post")
+			source := map[string]any{
+				"scaffold.yaml": "post_rules:\n  - pattern: \"*.txt\"\n    command: \"touch " + out + "\"\n",
+				"hello.txt":     "hello",
+			}
+
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: source, UseManifest: true, RestrictedFunctions: true}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "hello.txt"))).To(Equal([]byte("hello")))
+			Expect(out).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Describe("Directory data", func() {
+		It("Should merge _data.yaml into the data for the directory and below", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source: map[string]any{
+					"_data.yaml": "port: 80\nlabels:\n  app: web\n",
+					"top.txt":    "{{ .name }} {{ .port }} {{ .labels.app }}",
+					"sub": map[string]any{
+						"_data.yaml": "port: 443\nlabels:\n  tier: front\n",
+						"sub.txt":    "{{ .name }} {{ .port }} {{ .labels.app }} {{ .labels.tier }}",
+					},
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "top.txt"))).To(Equal([]byte("world 80 web")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "sub", "sub.txt"))).To(Equal([]byte("world 443 web front")))
+			Expect(filepath.Join(td, "target", "_data.yaml")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(td, "target", "sub", "_data.yaml")).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Describe("RenderString", func() {
+		It("Should support partials from memory sources", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source: map[string]any{
+					"_partials": map[string]any{"greet.txt": "hello {{ .name }}"},
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.RenderString(`{{ render "_partials/greet.txt" . }}`, map[string]any{"name": "world"})).To(Equal("hello world"))
+			Expect(s.RenderString(`{{ template "_partials/greet.txt" . }}!`, map[string]any{"name": "world"})).To(Equal("hello world!"))
+		})
+
+		It("Should support partials from source directories", func() {
+			src := filepath.Join(td, "source")
+			Expect(os.MkdirAll(filepath.Join(src, "_partials"), 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(src, "_partials", "greet.txt"), []byte("hello {{ .name }}"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(src, "file.txt"), []byte(`{{ template "_partials/greet.txt" . }}`), 0600)).To(Succeed())
+
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), SourceDirectory: src}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.RenderString(`{{ render "_partials/greet.txt" . }}`, map[string]any{"name": "world"})).To(Equal("hello world"))
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "file.txt"))).To(Equal([]byte("hello world")))
+		})
+	})
+
+	Describe("RenderBytes and RenderFile", func() {
+		It("Should render single templates", func() {
+			s, err := New(Config{
+				TargetDirectory:      filepath.Join(td, "target"),
+				Source:               map[string]any{"_partials": map[string]any{"greet.txt": "hello [[ .name ]]"}},
+				SkipEmpty:            true,
+				CustomLeftDelimiter:  "[[",
+				CustomRightDelimiter: "]]",
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.RenderBytes("x", []byte(`[[ render "_partials/greet.txt" . ]]`), map[string]any{"name": "world"})).To(Equal([]byte("hello world")))
+
+			_, err = s.RenderBytes("x", []byte(`[[ if false ]]x[[ end ]]`), nil)
+			Expect(err).To(MatchError(ErrSkippedEmpty))
+
+			src := filepath.Join(td, "tmpl.txt")
+			Expect(os.WriteFile(src, []byte(`[[ .name ]]`), 0600)).To(Succeed())
+			Expect(s.RenderFile(src, filepath.Join(td, "out", "file.txt"), map[string]any{"name": "world"})).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "out", "file.txt"))).To(Equal([]byte("world")))
+
+			Expect(s.RenderFile(src, filepath.Join(td, "out", "empty.txt"), map[string]any{"name": ""})).To(Succeed())
+			Expect(filepath.Join(td, "out", "empty.txt")).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Describe("Errors", func() {
+		It("Should return typed errors", func() {
+			_, err := New(Config{TargetDirectory: filepath.Join(td, "target")}, nil)
+			Expect(err).To(MatchError(ErrSourceMissing))
+
+			_, err = New(Config{TargetDirectory: filepath.Join(td, "target"), SourceDirectory: filepath.Join(td, "missing")}, nil)
+			Expect(err).To(MatchError(ErrSourceUnavailable))
+			Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+
+			_, err = New(Config{TargetDirectory: td, Source: map[string]any{"x": "x"}}, nil)
+			Expect(err).To(MatchError(ErrTargetExists))
+
+			Expect(os.MkdirAll(filepath.Join(td, "source"), 0700)).To(Succeed())
+			_, err = New(Config{TargetDirectory: filepath.Join(td, "source", "target"), SourceDirectory: filepath.Join(td, "source")}, nil)
+			Expect(err).To(MatchError(ErrSourceTargetOverlap))
+			_, err = New(Config{TargetDirectory: filepath.Join(td, "source-target"), SourceDirectory: filepath.Join(td, "source")}, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: map[string]any{"x": "{{ write \"../x\" \"x\" }}"}}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError(ErrPathEscape))
+
+			_, err = s.RenderString("{{ if }}", nil)
+			Expect(err).To(MatchError(ErrTemplateParse))
+
+			s, err = New(Config{TargetDirectory: filepath.Join(td, "other"), Source: map[string]any{"x": "x"}, Post: []map[string]string{{"*": "false"}}}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError(ErrPostProcessFailed))
+		})
+	})
+
+	Describe("Symlinked targets", func() {
+		It("Should allow targets below symlinked directories", func() {
+			// like /var being a symlink to /private/var on macOS
+			Expect(os.MkdirAll(filepath.Join(td, "private", "var"), 0700)).To(Succeed())
+			Expect(os.Symlink(filepath.Join(td, "private", "var"), filepath.Join(td, "var"))).To(Succeed())
+
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "var", "target"),
+				Source:          map[string]any{"a.txt": `{{ write "b.txt" "b" }}{{ readTarget "b.txt" }}`},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "private", "var", "target", "a.txt"))).To(Equal([]byte("b")))
+		})
+
+		It("Should reject writes through symlinks leaving the target", func() {
+			target := filepath.Join(td, "target")
+			s, err := New(Config{
+				TargetDirectory: target,
+				Source:          map[string]any{"a.txt": `{{ write "out/x.txt" "x" }}`},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(td, "outside"), 0700)).To(Succeed())
+			Expect(os.MkdirAll(target, 0700)).To(Succeed())
+			Expect(os.Symlink(filepath.Join(td, "outside"), filepath.Join(target, "out"))).To(Succeed())
+
+			Expect(s.Render(nil)).To(MatchError(ErrPathEscape))
+			Expect(filepath.Join(td, "outside", "x.txt")).ToNot(BeAnExistingFile())
+		})
+
+		It("Should reject sibling directories sharing the target prefix", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"a.txt": `{{ write "../target-other/x.txt" "x" }}`},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError(ErrPathEscape))
+		})
+	})
+
+	Describe("Case collisions", func() {
+		It("Should detect files differing only by case", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"README.md": `{{ write "Readme.md" "x" }}`},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError(ErrCaseCollision))
+		})
+
+		It("Should allow writing the same file again", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"a.md": `{{ write "b.md" "x" }}{{ write "b.md" "y" }}`},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+		})
+	})
+
+	Describe("NormalizePaths", func() {
+		It("Should normalize rendered file names", func() {
+			nfd := "cafe\u0301.txt"
+			nfc := "caf\u00e9.txt"
+
+			mfs := NewMemoryTargetFS()
+			s, err := New(Config{
+				TargetDirectory: "/target",
+				TargetFS:        mfs,
+				NormalizePaths:  "nfc",
+				Source:          map[string]any{nfd: `{{ write .name "x" }}`},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(map[string]any{"name": "sub" + nfd})).To(Succeed())
+			Expect(mfs.Files()).To(Equal([]string{"/target/" + nfc, "/target/sub" + nfc}))
+		})
+
+		It("Should validate the form", func() {
+			_, err := New(Config{TargetDirectory: "/target", NormalizePaths: "NFKC", Source: map[string]any{"x": "x"}}, nil)
+			Expect(err).To(MatchError(ContainSubstring("invalid path normalization")))
+		})
+	})
+
+	Describe("Memory sources", func() {
+		It("Should support binary, streamed and raw files", func() {
+			fsFile, err := fstest.MapFS{"f.txt": &fstest.MapFile{Data: []byte("fs {{ .name }}")}}.Open("f.txt")
+			Expect(err).ToNot(HaveOccurred())
+
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source: map[string]any{
+					"bytes.txt":  []byte("{{ .name }}"),
+					"reader.txt": strings.NewReader("{{ .name }}"),
+					"fs.txt":     fsFile,
+					"raw.txt":    File{Content: []byte("{{ .name }}"), Raw: true},
+					"script.sh":  &File{Content: []byte("echo {{ .name }}"), Mode: 0700},
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+
+			Expect(os.ReadFile(filepath.Join(td, "target", "bytes.txt"))).To(Equal([]byte("world")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "reader.txt"))).To(Equal([]byte("world")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "fs.txt"))).To(Equal([]byte("fs world")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "raw.txt"))).To(Equal([]byte("{{ .name }}")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "script.sh"))).To(Equal([]byte("echo world")))
+
+			stat, err := os.Stat(filepath.Join(td, "target", "script.sh"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stat.Mode().Perm()).To(Equal(fs.FileMode(0700)))
+		})
+
+		It("Should render streamed files more than once", func() {
+			fsFile, err := fstest.MapFS{"f.txt": &fstest.MapFile{Data: []byte("fs {{ .name }}")}}.Open("f.txt")
+			Expect(err).ToNot(HaveOccurred())
+
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source: map[string]any{
+					"reader.txt": strings.NewReader("hello {{ .name }}"),
+					"fs.txt":     fsFile,
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := s.RenderToMap(map[string]any{"name": "1"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res["reader.txt"]).To(Equal([]byte("hello 1")))
+
+			Expect(s.Render(map[string]any{"name": "2"})).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "reader.txt"))).To(Equal([]byte("hello 2")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "fs.txt"))).To(Equal([]byte("fs 2")))
+		})
+
+		It("Should reject nil files", func() {
+			var f *File
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: map[string]any{"nil.txt": f}}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError("invalid source entry nil.txt"))
+		})
+
+		It("Should support nested keys", func() {
+			source := map[string]any{
+				"cmd/app/main.go": "package main",
+				"cmd":             map[string]any{"other/x.go": "package other"},
+			}
+
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: source}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError(ContainSubstring("invalid file name")))
+
+			s, err = New(Config{TargetDirectory: filepath.Join(td, "nested"), Source: source, AllowNestedKeys: true}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(filepath.Join(td, "nested", "cmd", "app", "main.go")).To(BeARegularFile())
+			Expect(filepath.Join(td, "nested", "cmd", "other", "x.go")).To(BeARegularFile())
+
+			for i, k := range []string{"/abs.go", "a//b.go", "a/../b.go"} {
+				s, err = New(Config{TargetDirectory: filepath.Join(td, fmt.Sprintf("invalid%d", i)), Source: map[string]any{k: "x"}, AllowNestedKeys: true}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s.Render(nil)).To(MatchError(ContainSubstring("invalid file name")))
+			}
+		})
+
+		It("Should limit the depth of nested keys", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				AllowNestedKeys: true,
+				MaxSourceDepth:  2,
+				Source:          map[string]any{"a/b": map[string]any{"c/d.txt": "x"}},
+			}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError("source directory a/b/c exceeds the maximum depth of 2"))
+		})
+
+		It("Should reject unknown entries", func() {
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: map[string]any{"x": 1}}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError("invalid source entry x: 1"))
+		})
+
+		It("Should detect cycles", func() {
+			dir := map[string]any{"file": "x"}
+			dir["loop"] = map[string]any{"back": dir}
+
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: map[string]any{"dir": dir}}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError(`source directory dir/loop/back refers back to its parent directory "dir"`))
+		})
+
+		It("Should enforce the maximum depth", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				MaxSourceDepth:  1,
+				Source:          map[string]any{"a": map[string]any{"b": map[string]any{"c": "x"}}},
+			}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError("source directory a/b exceeds the maximum depth of 1"))
+		})
+
+		It("Should enforce the maximum files", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				MaxSourceFiles:  1,
+				Source:          map[string]any{"a": "a", "b": "b"},
+			}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError("source exceeds the maximum of 1 files"))
+		})
+	})
+
+	Describe("WorkingDirectory", func() {
+		It("Should resolve paths relative to the working directory", func() {
+			Expect(os.MkdirAll(filepath.Join(td, "source"), 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(td, "source", "a.txt"), []byte("{{ .name }}"), 0600)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(td, "bin"), 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(td, "bin", "post"), []byte("#!/bin/sh\necho post >> \"$1\"\n"), 0700)).To(Succeed())
+
+			cwd, err := os.Getwd()
+			Expect(err).ToNot(HaveOccurred())
+
+			s, err := New(Config{
+				WorkingDirectory: td,
+				SourceDirectory:  "source",
+				TargetDirectory:  "target",
+				PostRules:        []PostRule{{Pattern: "*.txt", Command: "./bin/post"}},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+
+			Expect(os.ReadFile(filepath.Join(td, "target", "a.txt"))).To(Equal([]byte("worldpost\n")))
+			Expect(os.Getwd()).To(Equal(cwd))
+		})
+	})
+
+	Describe("Fsync", func() {
+		It("Should render with fsync enabled", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Fsync:           true,
+				Source:          map[string]any{"a.txt": "a", "sub": map[string]any{"b.txt": "b"}},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "sub", "b.txt"))).To(Equal([]byte("b")))
+		})
+
+		It("Should sync every directory it creates", func() {
+			Expect(missingDirectories(td)).To(BeEmpty())
+			Expect(missingDirectories(filepath.Join(td, "a", "b", "c"))).To(Equal([]string{
+				filepath.Join(td, "a"),
+				filepath.Join(td, "a", "b"),
+				filepath.Join(td, "a", "b", "c"),
+			}))
+
+			Expect(osTargetFS{fsync: true}.MkdirAll(filepath.Join(td, "a", "b", "c"), 0700)).To(Succeed())
+			Expect(filepath.Join(td, "a", "b", "c")).To(BeADirectory())
+		})
+	})
+
+	Describe("SensitiveKeys", func() {
+		It("Should redact sensitive values in logs, reports and errors", func() {
+			log := &testLogger{}
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				SensitiveKeys:   []string{"db.password"},
+				Source:          map[string]any{"a.txt": "{{ .db.password }}"},
+				PostRules:       []PostRule{{Pattern: "*.txt", Command: "sh -c 'cat {}; exit 1'", AllowFailure: true}},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			s.Logger(log)
+			s.LogLevel(DebugLevel)
+
+			data := map[string]any{"db": map[string]any{"password": "s3cret"}}
+			Expect(s.Render(data)).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "a.txt"))).To(Equal([]byte("s3cret")))
+
+			Expect(strings.Join(log.lines, "\n")).ToNot(ContainSubstring("s3cret"))
+			Expect(strings.Join(log.lines, "\n")).To(ContainSubstring("***"))
+			Expect(s.Report().Files[0].Post[0].Output).To(Equal("***"))
+			Expect(s.Report().Warnings[0]).ToNot(ContainSubstring("s3cret"))
+
+			s, err = New(Config{
+				TargetDirectory: filepath.Join(td, "other"),
+				SensitiveKeys:   []string{"db.password"},
+				Source:          map[string]any{"a.txt": `{{ write (printf "../%s" .db.password) "x" }}`},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = s.Render(data)
+			Expect(err).To(MatchError(ErrPathEscape))
+			Expect(err.Error()).To(ContainSubstring("***"))
+			Expect(err.Error()).ToNot(ContainSubstring("s3cret"))
+		})
+
+		It("Should redact errors from every render entry point", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				SensitiveKeys:   []string{"db.password"},
+				Source:          map[string]any{"a.txt": "a"},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			data := map[string]any{"db": map[string]any{"password": "s3cret"}}
+
+			_, err = s.RenderString(`{{ fail (printf "bad %s" .db.password) }}`, data)
+			Expect(err).To(MatchError(ContainSubstring("bad ***")))
+
+			src := filepath.Join(td, "src.txt")
+			Expect(os.WriteFile(src, []byte(`{{ fail .db.password }}`), 0600)).To(Succeed())
+			err = s.RenderFile(src, filepath.Join(td, "dst.txt"), data)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).ToNot(ContainSubstring("s3cret"))
+			Expect(s.secrets).To(BeEmpty())
+		})
+
+		It("Should only redact short values as whole words and skip booleans", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				SensitiveKeys:   []string{"pin", "enabled", "flag"},
+				Source:          map[string]any{"a.txt": "a"},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			defer s.useSecrets(map[string]any{"pin": "42", "enabled": true, "flag": "true"})()
+			Expect(s.secrets).To(Equal([]string{"42"}))
+			Expect(s.redact("pin 42 in 1420 is true")).To(Equal("pin *** in 1420 is true"))
+		})
+
+		It("Should truncate trace arguments on a rune boundary", func() {
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: map[string]any{"a.txt": "a"}}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			arg := s.traceArgument(reflect.ValueOf(strings.Repeat("a", maxTraceArgument-1) + "éé"))
+			Expect(arg).To(Equal(strings.Repeat("a", maxTraceArgument-1) + "..."))
+			Expect(utf8.ValidString(arg)).To(BeTrue())
+		})
+	})
+
+	Describe("GitKeep", func() {
+		It("Should keep empty directories", func() {
+			source := map[string]any{
+				"empty":   map[string]any{"nested": map[string]any{}},
+				"skipped": map[string]any{"a.txt": "{{ if false }}x{{ end }}"},
+				"full":    map[string]any{"b.txt": "b"},
+			}
+
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "plain"), SkipEmpty: true, Source: source}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(filepath.Join(td, "plain", "empty", "nested")).To(BeADirectory())
+			Expect(filepath.Join(td, "plain", "empty", "nested", ".gitkeep")).ToNot(BeAnExistingFile())
+
+			s, err = New(Config{TargetDirectory: filepath.Join(td, "target"), SkipEmpty: true, GitKeep: true, Source: source}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+
+			Expect(filepath.Join(td, "target", "empty", "nested", ".gitkeep")).To(BeAnExistingFile())
+			Expect(filepath.Join(td, "target", "empty", ".gitkeep")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(td, "target", "skipped", ".gitkeep")).To(BeAnExistingFile())
+			Expect(filepath.Join(td, "target", "full", ".gitkeep")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(td, "target", ".gitkeep")).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Describe("Size limits", func() {
+		It("Should stop templates exceeding the file size", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				MaxFileSize:     10,
+				Source:          map[string]any{"a.txt": `{{ range $i := until 1000000 }}x{{ end }}`},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = s.Render(nil)
+			Expect(err).To(MatchError(ErrSizeLimitExceeded))
+
+			var serr *SizeLimitError
+			Expect(errors.As(err, &serr)).To(BeTrue())
+			Expect(serr.Limit).To(Equal(int64(10)))
+			Expect(serr.Total).To(BeFalse())
+			Expect(filepath.Join(td, "target", "a.txt")).ToNot(BeAnExistingFile())
+		})
+
+		It("Should limit the total output including write", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				MaxOutputSize:   10,
+				Source:          map[string]any{"a.txt": `{{ write "b.txt" "123456" }}1234`, "c.txt": `1`},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = s.Render(nil)
+			var serr *SizeLimitError
+			Expect(errors.As(err, &serr)).To(BeTrue())
+			Expect(serr.Total).To(BeTrue())
+			Expect(serr.Path).To(HaveSuffix("c.txt"))
+		})
+
+		It("Should only limit the total output of renders", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				MaxOutputSize:   10,
+				Source:          map[string]any{"a.txt": `123456789`},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(s.RenderString("hi", nil)).To(Equal("hi"))
+			Expect(s.RenderFile(filepath.Join(td, "target", "a.txt"), filepath.Join(td, "copy.txt"), nil)).To(Succeed())
+		})
+	})
+
+	Describe("Trace", func() {
+		It("Should record function calls and partials per file", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Trace:           true,
+				SensitiveKeys:   []string{"password"},
+				Source: map[string]any{
+					"_partials": map[string]any{"p.txt": `{{ lower "P" }}`},
+					"a.txt":     `{{ upper .name }}{{ template "_partials/p.txt" }}{{ .password | quote }}`,
+					"b.txt":     `b`,
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.Render(map[string]any{"name": "x", "password": "s3cret"})).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "a.txt"))).To(Equal([]byte(`Xp"s3cret"`)))
+
+			files := s.Report().Files
+			Expect(files).To(HaveLen(2))
+			Expect(files[0].Trace).To(Equal([]TraceEntry{
+				{Function: "template", Arguments: []string{"_partials/p.txt"}},
+				{Function: "upper", Arguments: []string{"x"}},
+				{Function: "lower", Arguments: []string{"P"}},
+				{Function: "quote", Arguments: []string{"***"}},
+			}))
+			Expect(files[1].Trace).To(BeEmpty())
+		})
+
+		It("Should not trace by default", func() {
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: map[string]any{"a.txt": `{{ upper "x" }}`}}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(s.Report().Files[0].Trace).To(BeNil())
+		})
+	})
+
+	Describe("Error suggestions", func() {
+		It("Should suggest similar functions and fields", func() {
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: map[string]any{"x": "x"}}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = s.RenderString(`{{ "x" | uper }}`, nil)
+			Expect(err).To(MatchError(ErrTemplateParse))
+			Expect(err).To(MatchError(HaveSuffix("did you mean upper?")))
+
+			_, err = s.RenderString(`{{ .ProjectNmae }}`, struct{ ProjectName string }{"x"})
+			Expect(err).To(MatchError(HaveSuffix("did you mean ProjectName?")))
+
+			_, err = s.RenderString(`{{ "x" | zzzzzzzz }}`, nil)
+			Expect(err).ToNot(MatchError(ContainSubstring("did you mean")))
+		})
+	})
+
+	Describe("Logging", func() {
+		var log *testLogger
+		var s *Scaffold
+
+		BeforeEach(func() {
+			var err error
+			log = &testLogger{}
+			s, err = New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"a.txt": "a"},
+				PostRules:       []PostRule{{Pattern: "*.txt", Command: "false", AllowFailure: true}},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			s.Logger(log)
+		})
+
+		It("Should default to info level", func() {
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(log.lines).To(HaveLen(3))
+			Expect(log.lines[0]).To(HavePrefix("info: Rendered"))
+			Expect(log.lines[1]).To(HavePrefix("info: Post processing using: false"))
+			Expect(log.lines[2]).To(HavePrefix("warn: Ignoring failed post processing"))
+		})
+
+		It("Should support levels", func() {
+			s.LogLevel(WarnLevel)
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(log.lines).To(HaveLen(1))
+			Expect(log.lines[0]).To(HavePrefix("warn: "))
+		})
+
+		It("Should support slog", func() {
+			buf := bytes.NewBuffer([]byte{})
+			s.Logger(NewSlogLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelWarn}))))
+			Expect(s.Render(nil)).To(Succeed())
+
+			var entry map[string]any
+			Expect(json.Unmarshal(buf.Bytes(), &entry)).To(Succeed())
+			Expect(entry["level"]).To(Equal("WARN"))
+			Expect(entry["msg"]).To(HavePrefix("Ignoring failed post processing"))
+		})
+
+		It("Should support disabling areas", func() {
+			s.LogLevel(DebugLevel)
+			s.DisableLogAreas(LogAreaPost)
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(log.lines).To(HaveLen(3))
+			Expect(log.lines[0]).To(HavePrefix("debug: Rendering"))
+			Expect(log.lines[1]).To(HavePrefix("info: Rendered"))
+			Expect(log.lines[2]).To(HavePrefix("warn: Ignoring failed post processing"))
+		})
+	})
+
+	Describe("TargetFS", func() {
+		It("Should render into the supplied filesystem", func() {
+			mfs := NewMemoryTargetFS()
+			s, err := New(Config{
+				TargetDirectory: "/target",
+				TargetFS:        mfs,
+				Source: map[string]any{
+					"hello.txt": `hello {{ .name }}{{ write "extra.txt" "extra" }}`,
+					"sub": map[string]any{
+						"sub.txt": `{{ .name | upper }}`,
+					},
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+			Expect(mfs.Files()).To(Equal([]string{"/target/extra.txt", "/target/hello.txt", "/target/sub/sub.txt"}))
+			Expect(mfs.ReadFile("/target/sub/sub.txt")).To(Equal([]byte("WORLD")))
+			Expect(filepath.Join(td, "target")).ToNot(BeADirectory())
+		})
+
+		It("Should render to a map", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source: map[string]any{
+					"hello.txt": `hello {{ .name }}{{ write "extra.txt" "extra" }}`,
+					"sub":       map[string]any{"sub.txt": `{{ .name | upper }}`},
+				},
+				PostRules: []PostRule{{Pattern: "*.txt", Command: "false"}},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			files, err := s.RenderToMap(map[string]any{"name": "world"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(files).To(Equal(map[string][]byte{
+				"hello.txt":   []byte("hello world"),
+				"extra.txt":   []byte("extra"),
+				"sub/sub.txt": []byte("WORLD"),
+			}))
+			Expect(filepath.Join(td, "target")).ToNot(BeAnExistingFile())
+		})
+
+		It("Should render to an archive", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source: map[string]any{
+					"hello.txt": `hello {{ .name }}`,
+					"bin":       map[string]any{"run.sh": &File{Content: []byte("echo {{ .name }}"), Mode: 0700}},
+					"empty":     map[string]any{},
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			buf := bytes.NewBuffer([]byte{})
+			Expect(s.RenderToArchive(buf, map[string]any{"name": "world"})).To(Succeed())
+			Expect(filepath.Join(td, "target")).ToNot(BeAnExistingFile())
+
+			gz, err := gzip.NewReader(buf)
+			Expect(err).ToNot(HaveOccurred())
+			tr := tar.NewReader(gz)
+
+			entries := map[string]string{}
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).ToNot(HaveOccurred())
+
+				content, err := io.ReadAll(tr)
+				Expect(err).ToNot(HaveOccurred())
+				entries[hdr.Name] = fmt.Sprintf("%o %s", hdr.Mode&0777, content)
+			}
+
+			Expect(entries).To(Equal(map[string]string{
+				"bin/":       "775 ",
+				"bin/run.sh": "700 echo world",
+				"empty/":     "775 ",
+				"hello.txt":  "755 hello world",
+			}))
+		})
+
+		It("Should detect existing targets", func() {
+			mfs := NewMemoryTargetFS()
+			Expect(mfs.MkdirAll("/target", 0700)).To(Succeed())
+
+			_, err := New(Config{TargetDirectory: "/target", TargetFS: mfs, Source: map[string]any{"x": "x"}}, nil)
+			Expect(err).To(MatchError("target directory exist"))
+		})
+
+		It("Should not support post processing", func() {
+			_, err := New(Config{
+				TargetDirectory: "/target",
+				TargetFS:        NewMemoryTargetFS(),
+				Source:          map[string]any{"x": "x"},
+				Post:            []map[string]string{{"*": "gofmt"}},
+			}, nil)
+			Expect(err).To(MatchError(ContainSubstring("post processing requires")))
+		})
+	})
+
+	Describe("Report", func() {
+		It("Should report rendered and skipped files", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				SkipEmpty:       true,
+				Post:            []map[string]string{{"*.txt": "true"}},
+				Source: map[string]any{
+					"hello.txt": "hello",
+					"empty.txt": "",
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Report()).To(BeNil())
+			Expect(s.Render(nil)).To(Succeed())
+
+			report := s.Report()
+			Expect(report.Target).To(Equal(filepath.Join(td, "target")))
+			Expect(report.Skipped).To(Equal([]string{"empty.txt"}))
+			Expect(report.Files).To(HaveLen(2))
+			Expect(report.Files[0]).To(Equal(ManagedFile{Path: "empty.txt", Action: FileActionSkipped, Reason: SkipReasonEmpty}))
+			Expect(report.Files[1].Path).To(Equal("hello.txt"))
+			Expect(report.Files[1].Action).To(Equal(FileActionAdd))
+			Expect(report.Files[1].Post).To(HaveLen(1))
+			Expect(report.Files[1].Post[0].Command).To(Equal("true " + filepath.Join(td, "target", "hello.txt")))
+			Expect(report.Files[1].Post[0].ExitCode).To(Equal(0))
+			Expect(report.Markdown()).To(ContainSubstring("| `hello.txt` | add |"))
+			Expect(report.Markdown()).To(ContainSubstring("| `empty.txt` | skipped |"))
+
+			stats := report.Stats()
+			Expect(stats.Added).To(Equal(1))
+			Expect(stats.Skipped).To(Equal(1))
+			Expect(stats.Bytes).To(Equal(int64(5)))
+			Expect(report.Summary()).To(HavePrefix("1 added, 1 skipped, 5 bytes in "))
+
+			Expect(report.WriteFile(filepath.Join(td, "report.json"))).To(Succeed())
+			rj, err := os.ReadFile(filepath.Join(td, "report.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(rj)).To(ContainSubstring(`"path": "hello.txt"`))
+		})
+	})
+
+	Describe("Post", func() {
+		It("Should run rules ordered by stage", func() {
+			order := filepath.Join(td, "order")
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"a.txt": "a", "b.txt": "b", "c.md": "c"},
+				PostRules: []PostRule{
+					{Pattern: "*.txt", Command: "sh -c 'echo late >> " + order + "'", Stage: 1},
+					{Command: "sh -c 'echo repo $(basename {}) >> " + order + "'"},
+					{Pattern: "*.txt", Command: "sh -c 'echo file $(basename {}) >> " + order + "'"},
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+
+			Expect(os.ReadFile(order)).To(Equal([]byte("file a.txt\nfile b.txt\nrepo target\nlate\nlate\n")))
+			Expect(s.Report().Post).To(HaveLen(1))
+			Expect(s.Report().Files[0].Post).To(HaveLen(2))
+			Expect(s.Report().Files[2].Post).To(BeEmpty())
+		})
+
+		It("Should pass single file paths with spaces as one argument", func() {
+			out := filepath.Join(td, "out")
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"my file.txt": "a"},
+				PostRules:       []PostRule{{Pattern: "*.txt", Command: "sh -c 'echo $# \"$1\" >> " + out + "' sh {}"}},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+
+			Expect(os.ReadFile(out)).To(Equal([]byte("1 " + filepath.Join(td, "target", "my file.txt") + "\n")))
+		})
+
+		It("Should list commands without running them in noop renders", func() {
+			order := filepath.Join(td, "order")
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"a.txt": "a", "b.md": `{{ addPost "" "touch done" }}`},
+				PostRules:       []PostRule{{Pattern: "*.txt", Command: "sh -c 'echo {} >> " + order + "'"}},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			report, err := s.RenderNoop(nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Noop).To(BeTrue())
+			Expect(report.Files[0].Post).To(HaveLen(1))
+			Expect(report.Files[0].Post[0].Command).To(ContainSubstring(filepath.Join(td, "target", "a.txt")))
+			Expect(report.Post).To(HaveLen(1))
+			Expect(report.Post[0].Command).To(Equal("touch done"))
+			Expect(report.Markdown()).To(ContainSubstring("Noop"))
+
+			Expect(order).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(td, "target")).ToNot(BeAnExistingFile())
+		})
+
+		It("Should load rules from a file with env, working directory and batch settings", func() {
+			out := filepath.Join(td, "out")
+			rules := filepath.Join(td, "post.yaml")
+			Expect(os.WriteFile(rules, []byte(`
+- pattern: "*.txt"
+  command: "sh -c 'echo $MODE $(pwd) $# >> `+out+`' sh"
+  batch: true
+  working_directory: sub
+  env:
+    MODE: batch
+- command: "sh -c 'echo repo >> `+out+`'"
+  stage: 1
+`), 0600)).To(Succeed())
+
+			loaded, err := LoadPostRules(rules)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded).To(HaveLen(2))
+			Expect(loaded[0].Batch).To(BeTrue())
+
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"a.txt": "a", "b.txt": "b", "sub": map[string]any{"c.md": "c"}},
+				PostRules:       loaded,
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+
+			target, err := filepath.EvalSymlinks(filepath.Join(td, "target"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.ReadFile(out)).To(Equal([]byte("batch " + filepath.Join(target, "sub") + " 2\nrepo\n")))
+			Expect(s.Report().Files[0].Post).To(Equal(s.Report().Files[1].Post))
+
+			Expect(os.WriteFile(rules, []byte("- command: x\n  working_directory: ../x\n"), 0600)).To(Succeed())
+			_, err = LoadPostRules(rules)
+			Expect(err).To(MatchError(ErrPathEscape))
+
+			Expect(os.WriteFile(rules, []byte("- command: x\n  unknown: x\n"), 0600)).To(Succeed())
+			_, err = LoadPostRules(rules)
+			Expect(err).To(MatchError(ContainSubstring("field unknown not found")))
+		})
+
+		It("Should match patterns with directories against the relative path", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source: map[string]any{
+					"ci.yaml": "ci",
+					"helm":    map[string]any{"values.yaml": "v", "templates": map[string]any{"deploy.yaml": "d"}},
+				},
+				PostRules: []PostRule{{Pattern: "helm/**/*.yaml", Command: "true"}},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+
+			posts := map[string]int{}
+			for _, f := range s.Report().Files {
+				posts[f.Path] = len(f.Post)
+			}
+			Expect(posts).To(Equal(map[string]int{"ci.yaml": 0, "helm/values.yaml": 1, "helm/templates/deploy.yaml": 1}))
+
+			_, err = New(Config{
+				TargetDirectory: filepath.Join(td, "other"),
+				Source:          map[string]any{"x": "x"},
+				PostRules:       []PostRule{{Pattern: "helm/[", Command: "true"}},
+			}, map[string]any{})
+			Expect(err).To(MatchError(ContainSubstring("invalid post processing pattern")))
+		})
+	})
+
+	Describe("Post failures", func() {
+		It("Should retry failed commands", func() {
+			counter := filepath.Join(td, "counter")
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"a.txt": "a"},
+				PostRules: []PostRule{
+					// fails until the counter file has 3 lines
+					{Pattern: "*.txt", Command: "sh -c 'echo x >> " + counter + "; test $(wc -l < " + counter + ") -ge 3'", Retries: 2},
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(s.Report().Files[0].Post).To(HaveLen(1))
+		})
+
+		It("Should fail when retries are exhausted", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"a.txt": "a"},
+				PostRules:       []PostRule{{Pattern: "*.txt", Command: "false", Retries: 1}},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError(ContainSubstring("failed to post process")))
+		})
+
+		It("Should support allowing failures", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"a.txt": "a"},
+				PostRules:       []PostRule{{Pattern: "*.txt", Command: "sh -c 'echo flaky; exit 1'", AllowFailure: true}},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(s.Report().Files[0].Post).To(HaveLen(1))
+			Expect(s.Report().Files[0].Post[0].ExitCode).To(Equal(1))
+			Expect(s.Report().Files[0].Post[0].Output).To(Equal("flaky\n"))
+			Expect(s.Report().Warnings).To(HaveLen(1))
+			Expect(s.Report().Warnings[0]).To(ContainSubstring("flaky"))
+		})
+	})
+
+	Describe("readTarget", func() {
+		It("Should read files from the target", func() {
+			mfs := NewMemoryTargetFS()
+			s, err := New(Config{
+				TargetDirectory: "/target",
+				TargetFS:        mfs,
+				Source: map[string]any{
+					"a.txt": "a content",
+					"b.txt": `{{ readTarget "a.txt" | upper }}`,
+					"c.txt": `{{ readTarget "../etc/passwd" }}`,
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError(ErrPathEscape))
+			Expect(mfs.ReadFile("/target/b.txt")).To(Equal([]byte("A CONTENT")))
+		})
+	})
+
+	Describe("mkdir", func() {
+		It("Should create directories in the target", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"a.txt": `{{ mkdir (printf "cmd/%s" .name) }}{{ mkdir "../escape" }}`},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.Render(map[string]any{"name": "app"})).To(MatchError(ErrPathEscape))
+			Expect(filepath.Join(td, "target", "cmd", "app")).To(BeADirectory())
+			Expect(filepath.Join(td, "escape")).ToNot(BeAnExistingFile())
+			Expect(s.Report().Directories).To(Equal([]string{"cmd/app"}))
+		})
+	})
+
+	Describe("addPost", func() {
+		It("Should register post processing from templates", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source: map[string]any{
+					"a.tf":   `{{ if .terraform }}{{ addPost "*.tf" "sh -c 'echo formatted >> {}'" }}{{ end }}resource`,
+					"b.txt":  "b",
+					"c.json": `{{ addPost "" "touch done" }}`,
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(map[string]any{"terraform": true})).To(Succeed())
+
+			Expect(os.ReadFile(filepath.Join(td, "target", "a.tf"))).To(Equal([]byte("resourceformatted\n")))
+			Expect(filepath.Join(td, "target", "done")).To(BeARegularFile())
+		})
+
+		It("Should not support memory targets", func() {
+			s, err := New(Config{
+				TargetDirectory: "/target",
+				TargetFS:        NewMemoryTargetFS(),
+				Source:          map[string]any{"a.tf": `{{ addPost "*.tf" "terraform fmt" }}`},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError(ContainSubstring("post processing requires")))
+		})
+	})
+
+	Describe("Git", func() {
+		It("Should commit into a new branch", func() {
+			for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+				GinkgoT().Setenv(k, "test")
+			}
+			for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+				GinkgoT().Setenv(k, "test@example.net")
+			}
+
+			repo := filepath.Join(td, "repo")
+			remote := filepath.Join(td, "remote.git")
+			_, err := New(Config{TargetDirectory: filepath.Join(repo, "generated"), Source: map[string]any{"x": "x"}, Git: &GitOutput{Branch: "scaffold"}}, nil)
+			Expect(err).To(MatchError(ContainSubstring("requires the target to be in a git repository")))
+
+			_, err = git(td, "init", "-q", "--bare", remote)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = git(td, "init", "-q", repo)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = git(repo, "symbolic-ref", "HEAD", "refs/heads/main")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(repo, "README.md"), []byte("readme"), 0600)).To(Succeed())
+			_, err = git(repo, "add", "README.md")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = git(repo, "commit", "-q", "-m", "initial")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = git(repo, "remote", "add", "origin", remote)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = New(Config{TargetDirectory: filepath.Join(repo, "generated"), Source: map[string]any{"x": "x"}, Git: &GitOutput{Branch: "main"}}, nil)
+			Expect(err).To(MatchError("git branch main already exists"))
+
+			_, err = New(Config{TargetDirectory: filepath.Join(repo, "generated"), Source: map[string]any{"x": "x"}, Git: &GitOutput{Branch: "x", PullRequestCommand: "true"}}, nil)
+			Expect(err).To(MatchError("git pull requests require a remote"))
+
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(repo, "generated"),
+				Source:          map[string]any{"hello.txt": "hello {{ .name }}"},
+				Git: &GitOutput{
+					Branch:             "scaffold",
+					Message:            "Generated for {{ .name }}",
+					Remote:             "origin",
+					PullRequestCommand: `sh -c 'echo "$SCAFFOLD_GIT_REMOTE $SCAFFOLD_GIT_BRANCH $SCAFFOLD_GIT_MESSAGE" > ../pr'`,
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+
+			Expect(git(repo, "rev-parse", "--abbrev-ref", "HEAD")).To(Equal("main"))
+			Expect(git(repo, "status", "--porcelain")).To(Equal("?? generated/"))
+			Expect(git(repo, "log", "-1", "--format=%s", "scaffold")).To(Equal("Generated for world"))
+			Expect(git(repo, "show", "scaffold:generated/hello.txt")).To(Equal("hello world"))
+			Expect(git(repo, "show", "scaffold:README.md")).To(Equal("readme"))
+			Expect(git(remote, "show", "scaffold:generated/hello.txt")).To(Equal("hello world"))
+			Expect(os.ReadFile(filepath.Join(td, "pr"))).To(Equal([]byte("origin scaffold Generated for world\n")))
+		})
+
+		It("Should commit into a new branch of an empty repository", func() {
+			for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+				GinkgoT().Setenv(k, "test")
+			}
+			for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+				GinkgoT().Setenv(k, "test@example.net")
+			}
+
+			_, err := git(td, "init", "-q")
+			Expect(err).ToNot(HaveOccurred())
+
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "generated"),
+				Source:          map[string]any{"hello.txt": "hello {{ .name }}"},
+				Git:             &GitOutput{Branch: "scaffold"},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+
+			Expect(git(td, "log", "-1", "--format=%s", "scaffold")).To(Equal("Render scaffold into generated"))
+			Expect(git(td, "show", "scaffold:generated/hello.txt")).To(Equal("hello world"))
+		})
+
+		It("Should initialize a new repository", func() {
+			for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+				GinkgoT().Setenv(k, "test")
+			}
+			for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+				GinkgoT().Setenv(k, "test@example.net")
+			}
+
+			target := filepath.Join(td, "project")
+			s, err := New(Config{
+				TargetDirectory: target,
+				Source:          map[string]any{"hello.txt": "hello {{ .name }}", "run.sh": "echo [[ .name ]]"},
+				Overrides:       []FileOverride{{Pattern: "*.sh", LeftDelimiter: "[[", RightDelimiter: "]]"}},
+				GitInit:         &GitInit{Branch: "trunk", Message: "Scaffold {{ .name }}", RemoteURL: "https://example.net/project.git"},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(map[string]any{"name": "world"})).To(Succeed())
+
+			Expect(git(target, "rev-parse", "--abbrev-ref", "HEAD")).To(Equal("trunk"))
+			Expect(git(target, "log", "-1", "--format=%s")).To(Equal("Scaffold world"))
+			Expect(git(target, "show", "HEAD:hello.txt")).To(Equal("hello world"))
+			Expect(git(target, "remote", "get-url", "origin")).To(Equal("https://example.net/project.git"))
+		})
+
+		It("Should expose repository metadata to templates", func() {
+			for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+				GinkgoT().Setenv(k, "test")
+			}
+			for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+				GinkgoT().Setenv(k, "test@example.net")
+			}
+
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "new", "target"), Source: map[string]any{"x": "x"}}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.RenderString(`{{ gitRemote }}|{{ gitBranch }}|{{ gitLastTag }}`, nil)).To(Equal("||"))
+
+			_, err = git(td, "init", "-q")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = git(td, "symbolic-ref", "HEAD", "refs/heads/main")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = git(td, "commit", "-q", "--allow-empty", "-m", "initial")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = git(td, "tag", "v1.2.3")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = git(td, "remote", "add", "upstream", "https://example.net/x.git")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.RenderString(`{{ gitRemote "upstream" }}|{{ gitRemote }}|{{ gitBranch }}|{{ gitLastTag }}`, nil)).To(Equal("https://example.net/x.git||main|v1.2.3"))
+		})
+
+		It("Should not pass git initialization settings as options", func() {
+			for _, gi := range []GitInit{{Branch: "-x"}, {Branch: "a..b"}, {RemoteURL: "--upload-pack=x"}, {RemoteURL: "x", RemoteName: "-x"}, {RemoteURL: "x", RemoteName: "a b"}} {
+				_, err := New(Config{TargetDirectory: filepath.Join(td, "x"), Source: map[string]any{"x": "x"}, GitInit: &gi}, nil)
+				Expect(err).To(MatchError(HavePrefix("invalid git")))
+			}
+		})
+
+		It("Should not combine git output and initialization", func() {
+			_, err := New(Config{TargetDirectory: filepath.Join(td, "x"), Source: map[string]any{"x": "x"}, Git: &GitOutput{Branch: "x"}, GitInit: &GitInit{}}, nil)
+			Expect(err).To(MatchError(ContainSubstring("mutually exclusive")))
+		})
+	})
+
+	Describe("RestrictedFunctions", func() {
+		It("Should remove functions with environment access", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"x": "x"},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = s.RenderString(`{{ env "HOME" }}`, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			s, err = New(Config{
+				TargetDirectory:     filepath.Join(td, "target"),
+				Source:              map[string]any{"x": "x"},
+				RestrictedFunctions: true,
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, f := range []string{"env", "expandenv", "getHostByName"} {
+				_, err = s.RenderString(`{{ `+f+` "HOME" }}`, nil)
+				Expect(err).To(MatchError(ContainSubstring(`function "` + f + `" not defined`)))
+			}
+
+			Expect(s.RenderString(`{{ "x" | upper }}`, nil)).To(Equal("X"))
+		})
+
+		It("Should not render templates outside the source", func() {
+			Expect(os.WriteFile(filepath.Join(td, "secret"), []byte("secret"), 0600)).To(Succeed())
+			src := filepath.Join(td, "src")
+			Expect(os.MkdirAll(src, 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(src, "out.txt"), []byte(`{{ render "../secret" . }}`), 0600)).To(Succeed())
+
+			s, err := New(Config{
+				TargetDirectory:     filepath.Join(td, "target"),
+				SourceDirectory:     src,
+				RestrictedFunctions: true,
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = s.Render(nil)
+			Expect(err).To(MatchError(ErrPathEscape))
+
+			s, err = New(Config{
+				TargetDirectory: filepath.Join(td, "target2"),
+				SourceDirectory: src,
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target2", "out.txt"))).To(Equal([]byte("secret")))
+		})
+
+		It("Should not read files outside the target", func() {
+			Expect(os.WriteFile(filepath.Join(td, "secret"), []byte("secret"), 0600)).To(Succeed())
+
+			s, err := New(Config{
+				TargetDirectory:     filepath.Join(td, "target"),
+				Source:              map[string]any{"x": `{{ readTarget "../secret" }}`},
+				RestrictedFunctions: true,
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = s.Render(nil)
+			Expect(err).To(MatchError(ErrPathEscape))
+		})
+
+		It("Should not allow templates to add post processing commands", func() {
+			s, err := New(Config{
+				TargetDirectory:     filepath.Join(td, "target"),
+				Source:              map[string]any{"x": `{{ addPost "" "touch pwned" }}`},
+				RestrictedFunctions: true,
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = s.Render(nil)
+			Expect(err).To(MatchError(ContainSubstring(`function "addPost" not defined`)))
+			Expect(filepath.Join(td, "target", "pwned")).ToNot(BeAnExistingFile())
+		})
+	})
+
+	Describe("Go helpers", func() {
+		It("Should sanitize identifiers and module paths", func() {
+			Expect(goIdent("my-project")).To(Equal("my_project"))
+			Expect(goIdent("1st")).To(Equal("_1st"))
+			Expect(goIdent("type")).To(Equal("type_"))
+			Expect(goIdent("")).To(Equal("_"))
+			Expect(goModulePath(" GitHub.com/Org/My Project/ ")).To(Equal("github.com/org/my-project"))
+			Expect(goVersion()).ToNot(HavePrefix("go"))
+		})
+
+		It("Should format rendered Go files", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				FormatGo:        true,
+				Source: map[string]any{
+					"main.go":   "package   {{ goIdent .name }}\nfunc  x( ) {}\n{{ write \"other.go\" \"package  x\" }}",
+					"README.md": "package   x",
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(s.Render(map[string]any{"name": "my-app"})).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "target", "main.go"))).To(Equal([]byte("package my_app\n\nfunc x() {}\n")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "other.go"))).To(Equal([]byte("package x\n")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "README.md"))).To(Equal([]byte("package   x")))
+
+			s, err = New(Config{TargetDirectory: filepath.Join(td, "invalid"), FormatGo: true, Source: map[string]any{"main.go": "func"}}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(MatchError(ContainSubstring("formatting")))
+		})
+	})
+
+	Describe("LicenseHeader", func() {
+		It("Should add headers using the comment syntax of each file", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				LicenseHeader:   &LicenseHeader{SPDX: "Apache-2.0", Copyright: "Copyright (c) 2024, Example"},
+				Source: map[string]any{
+					"main.go":    "package main\n",
+					"run.sh":     "#!/bin/sh\necho hi\n",
+					"style.css":  "body {}\n",
+					"data.bin":   "data",
+					"custom.yml": "{{ licenseHeader \"MIT\" \"\" }}x: 1\n",
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+
+			Expect(os.ReadFile(filepath.Join(td, "target", "main.go"))).To(Equal([]byte("// Copyright (c) 2024, Example\n//\n// SPDX-License-Identifier: Apache-2.0\n\npackage main\n")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "run.sh"))).To(Equal([]byte("#!/bin/sh\n# Copyright (c) 2024, Example\n#\n# SPDX-License-Identifier: Apache-2.0\n\necho hi\n")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "style.css"))).To(Equal([]byte("/*\n * Copyright (c) 2024, Example\n *\n * SPDX-License-Identifier: Apache-2.0\n */\n\nbody {}\n")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "data.bin"))).To(Equal([]byte("data")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "custom.yml"))).To(Equal([]byte("# SPDX-License-Identifier: MIT\nx: 1\n")))
+		})
+
+		It("Should only add headers to matching files", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				LicenseHeader:   &LicenseHeader{SPDX: "MIT", Patterns: []string{"src/**"}},
+				Source:          map[string]any{"a.go": "package a\n", "src": map[string]any{"b.go": "package b\n"}},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+
+			Expect(os.ReadFile(filepath.Join(td, "target", "a.go"))).To(Equal([]byte("package a\n")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "src", "b.go"))).To(Equal([]byte("// SPDX-License-Identifier: MIT\n\npackage b\n")))
+		})
+
+		It("Should keep XML declarations and doctypes first", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				LicenseHeader:   &LicenseHeader{SPDX: "MIT"},
+				Source: map[string]any{
+					"pom.xml":    "<?xml version=\"1.0\"?>\n<project/>\n",
+					"index.html": "<!DOCTYPE html>\n<html></html>\n",
+					"feed.xml":   "<?xml version=\"1.0\"?><!DOCTYPE feed [<!ENTITY x \"y\">]><feed/>\n",
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+
+			Expect(os.ReadFile(filepath.Join(td, "target", "pom.xml"))).To(Equal([]byte("<?xml version=\"1.0\"?>\n<!--\n  SPDX-License-Identifier: MIT\n-->\n\n<project/>\n")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "index.html"))).To(Equal([]byte("<!DOCTYPE html>\n<!--\n  SPDX-License-Identifier: MIT\n-->\n\n<html></html>\n")))
+			Expect(os.ReadFile(filepath.Join(td, "target", "feed.xml"))).To(Equal([]byte("<?xml version=\"1.0\"?><!DOCTYPE feed [<!ENTITY x \"y\">]>\n<!--\n  SPDX-License-Identifier: MIT\n-->\n\n<feed/>\n")))
+		})
+
+		It("Should write a LICENSE file unless one is rendered", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				LicenseHeader:   &LicenseHeader{SPDX: "MIT", Copyright: "Copyright (c) 2024, Example", License: true},
+				Source:          map[string]any{"a.go": "package a\n"},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+
+			license, err := os.ReadFile(filepath.Join(td, "target", "LICENSE"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(license)).To(HavePrefix("MIT License\n\nCopyright (c) 2024, Example\n\nPermission is hereby granted"))
+			Expect(s.Report().Files).To(HaveLen(2))
+
+			s, err = New(Config{
+				TargetDirectory: filepath.Join(td, "own"),
+				UseManifest:     true,
+				Source: map[string]any{
+					"scaffold.yaml": "license_header:\n  spdx: Apache-2.0\n  license: true\n",
+					"LICENSE":       "custom",
+				},
+			}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.Render(nil)).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(td, "own", "LICENSE"))).To(Equal([]byte("custom")))
+
+			_, err = New(Config{
+				TargetDirectory: filepath.Join(td, "other"),
+				LicenseHeader:   &LicenseHeader{SPDX: "GPL-3.0-only", License: true},
+				Source:          map[string]any{"a.go": "package a\n"},
+			}, map[string]any{})
+			Expect(err).To(MatchError("no license text available for GPL-3.0-only"))
+		})
+	})
+
+	Describe("TemplateFunctions", func() {
+		It("Should list all functions with their source", func() {
+			s, err := New(Config{
+				TargetDirectory: filepath.Join(td, "target"),
+				Source:          map[string]any{"x": "x"},
+			}, map[string]any{"greet": func(n string) string { return "hello " + n }})
+			Expect(err).ToNot(HaveOccurred())
+
+			funcs := map[string]TemplateFunction{}
+			for _, f := range s.TemplateFunctions() {
+				funcs[f.Name] = f
+			}
+
+			Expect(funcs["write"]).To(Equal(TemplateFunction{Name: "write", Signature: "(string, string) (string, error)", Description: builtinFunctions["write"], Source: "builtin"}))
+			Expect(funcs["greet"]).To(Equal(TemplateFunction{Name: "greet", Signature: "(string) string", Source: "custom"}))
+			Expect(funcs["upper"].Source).To(Equal("sprig"))
+			Expect(funcs["leftDelim"].Source).To(Equal("builtin"))
+		})
+
+		It("Should emit literal delimiters", func() {
+			s, err := New(Config{TargetDirectory: filepath.Join(td, "target"), Source: map[string]any{"x": "x"}}, map[string]any{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.RenderString(`image: {{ leftDelim }} .Values.{{ .key }} {{ rightDelim }}`, map[string]any{"key": "image"})).To(Equal("image: {{ .Values.image }}"))
+		})
+	})
+})
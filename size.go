@@ -0,0 +1,64 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"fmt"
+)
+
+// SizeLimitError indicates a rendered file or the total render output exceeded Config.MaxFileSize or Config.MaxOutputSize
+type SizeLimitError struct {
+	// Path is the file being rendered when the limit was exceeded
+	Path string
+	// Limit is the limit that was exceeded in bytes
+	Limit int64
+	// Total indicates the limit is Config.MaxOutputSize rather than Config.MaxFileSize
+	Total bool
+}
+
+func (e *SizeLimitError) Error() string {
+	if e.Total {
+		return fmt.Sprintf("%s: rendering %s exceeds the maximum output size of %d bytes", ErrSizeLimitExceeded, e.Path, e.Limit)
+	}
+
+	return fmt.Sprintf("%s: %s exceeds the maximum file size of %d bytes", ErrSizeLimitExceeded, e.Path, e.Limit)
+}
+
+func (e *SizeLimitError) Unwrap() error {
+	return ErrSizeLimitExceeded
+}
+
+// checkSize ensures a file of size bytes fits within the configured file size limit and, while rendering, the total output limit
+func (s *Scaffold) checkSize(f string, size int64) error {
+	if s.cfg.MaxFileSize > 0 && size > s.cfg.MaxFileSize {
+		return &SizeLimitError{Path: f, Limit: s.cfg.MaxFileSize}
+	}
+
+	if s.cfg.MaxOutputSize > 0 && s.countOutput && s.outputSize+size > s.cfg.MaxOutputSize {
+		return &SizeLimitError{Path: f, Limit: s.cfg.MaxOutputSize, Total: true}
+	}
+
+	return nil
+}
+
+// sizeLimitWriter fails writes once the content would exceed the configured limits, stopping runaway templates early
+type sizeLimitWriter struct {
+	s    *Scaffold
+	name string
+	size int64
+	buf  []byte
+}
+
+func (w *sizeLimitWriter) Write(p []byte) (int, error) {
+	err := w.s.checkSize(w.name, w.size+int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+
+	w.size += int64(len(p))
+	w.buf = append(w.buf, p...)
+
+	return len(p), nil
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+const (
+	// DefaultMaxSourceDepth is the default for Config.MaxSourceDepth
+	DefaultMaxSourceDepth = 32
+	// DefaultMaxSourceFiles is the default for Config.MaxSourceFiles
+	DefaultMaxSourceFiles = 10000
+)
+
+// File is a file in an in-memory source with additional metadata
+type File struct {
+	// Content is the file content
+	Content []byte
+	// Mode is the permissions of the rendered file, defaults to 0755
+	Mode fs.FileMode
+	// Raw copies the content to the target as is without template processing
+	Raw bool
+}
+
+// sourceDump tracks the state of writing an in-memory source to disk
+type sourceDump struct {
+	maxDepth int
+	maxFiles int
+	files    int
+	// parents are the directories currently being written, used to detect cycles
+	parents map[uintptr]string
+}
+
+func (s *Scaffold) dumpSourceDir(source map[string]any, target string) error {
+	s.sourceMeta = make(map[string]File)
+
+	state := &sourceDump{
+		maxDepth: s.cfg.MaxSourceDepth,
+		maxFiles: s.cfg.MaxSourceFiles,
+		parents:  make(map[uintptr]string),
+	}
+
+	if state.maxDepth <= 0 {
+		state.maxDepth = DefaultMaxSourceDepth
+	}
+	if state.maxFiles <= 0 {
+		state.maxFiles = DefaultMaxSourceFiles
+	}
+
+	return s.dumpSourceDirEntries(state, source, target, ".", 0)
+}
+
+func (s *Scaffold) dumpSourceDirEntries(state *sourceDump, source map[string]any, target string, name string, depth int) error {
+	if depth > state.maxDepth {
+		return fmt.Errorf("source directory %s exceeds the maximum depth of %d", name, state.maxDepth)
+	}
+
+	ptr := reflect.ValueOf(source).Pointer()
+	if parent, ok := state.parents[ptr]; ok {
+		return fmt.Errorf("source directory %s refers back to its parent directory %q", name, parent)
+	}
+	state.parents[ptr] = name
+	defer delete(state.parents, ptr)
+
+	for k, v := range source {
+		if strings.Contains(k, "..") {
+			return fmt.Errorf("%w: invalid file name %v", ErrPathEscape, k)
+		}
+		if strings.Contains(k, `\`) {
+			return fmt.Errorf("invalid file name %v", k)
+		}
+
+		out := filepath.Join(target, filepath.FromSlash(k))
+		entryName := filepath.ToSlash(filepath.Join(name, k))
+		entryDepth := depth
+
+		if strings.Contains(k, "/") {
+			if !s.cfg.AllowNestedKeys {
+				return fmt.Errorf("invalid file name %v", k)
+			}
+
+			for _, part := range strings.Split(k, "/") {
+				if part == "" {
+					return fmt.Errorf("invalid file name %v", k)
+				}
+			}
+
+			entryDepth += strings.Count(k, "/")
+			if entryDepth > state.maxDepth {
+				return fmt.Errorf("source directory %s exceeds the maximum depth of %d", path.Dir(entryName), state.maxDepth)
+			}
+
+			err := os.MkdirAll(filepath.Dir(out), 0700)
+			if err != nil {
+				return err
+			}
+		}
+
+		switch e := v.(type) {
+		case string: // a file
+			err := s.dumpSourceFile(state, out, File{Content: []byte(e)})
+			if err != nil {
+				return err
+			}
+
+		case []byte:
+			err := s.dumpSourceFile(state, out, File{Content: e})
+			if err != nil {
+				return err
+			}
+
+		case File:
+			err := s.dumpSourceFile(state, out, e)
+			if err != nil {
+				return err
+			}
+
+		case *File:
+			if e == nil {
+				return fmt.Errorf("invalid source entry %s", entryName)
+			}
+
+			err := s.dumpSourceFile(state, out, *e)
+			if err != nil {
+				return err
+			}
+
+		case map[string]any: // a directory
+			// nested keys might have created this directory already
+			err := os.MkdirAll(out, 0700)
+			if err != nil {
+				return err
+			}
+
+			err = s.dumpSourceDirEntries(state, e, out, entryName, entryDepth+1)
+			if err != nil {
+				return err
+			}
+
+		default: // a mistake
+			return fmt.Errorf("invalid source entry %s: %v", entryName, v)
+		}
+	}
+
+	return nil
+}
+
+// readSourceStreams copies source replacing fs.File and io.Reader entries with their content so the source can be
+// written out on every render, files are closed after reading. Directories that refer back to a parent refer to
+// the copy of that parent so dumpSourceDir reports them as before
+func readSourceStreams(source map[string]any, name string, parents map[uintptr]map[string]any) (map[string]any, error) {
+	ptr := reflect.ValueOf(source).Pointer()
+	if dir, ok := parents[ptr]; ok {
+		return dir, nil
+	}
+
+	res := make(map[string]any, len(source))
+	parents[ptr] = res
+	defer delete(parents, ptr)
+
+	for k, v := range source {
+		entryName := path.Join(name, k)
+
+		switch e := v.(type) {
+		case string, []byte, File, *File:
+			res[k] = e
+
+		case fs.File:
+			content, err := io.ReadAll(e)
+			e.Close()
+			if err != nil {
+				return nil, fmt.Errorf("could not read source entry %s: %w", entryName, err)
+			}
+			res[k] = File{Content: content}
+
+		case io.Reader:
+			content, err := io.ReadAll(e)
+			if err != nil {
+				return nil, fmt.Errorf("could not read source entry %s: %w", entryName, err)
+			}
+			res[k] = File{Content: content}
+
+		case map[string]any:
+			dir, err := readSourceStreams(e, entryName, parents)
+			if err != nil {
+				return nil, err
+			}
+			res[k] = dir
+
+		default:
+			res[k] = v
+		}
+	}
+
+	return res, nil
+}
+
+func (s *Scaffold) dumpSourceFile(state *sourceDump, out string, f File) error {
+	state.files++
+	if state.files > state.maxFiles {
+		return fmt.Errorf("source exceeds the maximum of %d files", state.maxFiles)
+	}
+
+	err := os.WriteFile(out, f.Content, 0400)
+	if err != nil {
+		return err
+	}
+
+	if f.Mode != 0 || f.Raw {
+		s.sourceMeta[out] = File{Mode: f.Mode, Raw: f.Raw}
+	}
+
+	return nil
+}
+
+func (s *Scaffold) createTempDirForSource() (string, error) {
+	td, err := os.MkdirTemp("", "")
+	if err != nil {
+		return "", err
+	}
+
+	err = s.dumpSourceDir(s.cfg.Source, td)
+	if err != nil {
+		os.RemoveAll(td)
+		return "", err
+	}
+
+	return td, nil
+}
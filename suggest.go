@@ -0,0 +1,116 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	undefinedFunctionRe = regexp.MustCompile(`function "([^"]+)" not defined`)
+	missingFieldRe      = regexp.MustCompile(`can't evaluate field (\w+)|map has no entry for key "([^"]+)"`)
+)
+
+// suggestion is a "did you mean" hint for template errors referencing unknown functions or data keys, empty when
+// there is no close match
+func (s *Scaffold) suggestion(err error, data any) string {
+	msg := err.Error()
+
+	if m := undefinedFunctionRe.FindStringSubmatch(msg); m != nil {
+		var names []string
+		for name := range s.templateFuncs() {
+			names = append(names, name)
+		}
+
+		return didYouMean(m[1], names)
+	}
+
+	if m := missingFieldRe.FindStringSubmatch(msg); m != nil {
+		name := m[1] + m[2]
+
+		return didYouMean(name, dataKeys(data))
+	}
+
+	return ""
+}
+
+// dataKeys are the top level keys or field names of data
+func dataKeys(data any) []string {
+	var res []string
+
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			if k.Kind() == reflect.String {
+				res = append(res, k.String())
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				res = append(res, v.Type().Field(i).Name)
+			}
+		}
+	}
+
+	return res
+}
+
+// didYouMean suggests the closest of candidates to name, ignoring case, when it is reasonably similar
+func didYouMean(name string, candidates []string) string {
+	sort.Strings(candidates)
+
+	best := ""
+	bestDistance := max(1, len(name)/3) + 1
+
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+
+		d := levenshtein(strings.ToLower(name), strings.ToLower(c))
+		if d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+
+	return "did you mean " + best + "?"
+}
+
+func levenshtein(a string, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(br)]
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TargetFS is a filesystem that rendered files are written to
+type TargetFS interface {
+	// MkdirAll creates a directory and all its parents
+	MkdirAll(path string, perm fs.FileMode) error
+	// WriteFile writes data to the named file, creating it if needed
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	// Stat returns information about a file, errors must match fs.ErrNotExist for absent files
+	Stat(name string) (fs.FileInfo, error)
+	// ReadFile reads the contents of a file
+	ReadFile(name string) ([]byte, error)
+}
+
+type osTargetFS struct {
+	fsync bool
+}
+
+func (t osTargetFS) MkdirAll(path string, perm fs.FileMode) error {
+	if !t.fsync {
+		return os.MkdirAll(path, perm)
+	}
+
+	created := missingDirectories(path)
+
+	err := os.MkdirAll(path, perm)
+	if err != nil {
+		return err
+	}
+
+	// every new directory is only durable once the directory holding it is synced
+	for _, dir := range created {
+		err = syncDir(filepath.Dir(dir))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// missingDirectories are path and its parents that do not exist, from the top down
+func missingDirectories(path string) []string {
+	var missing []string
+
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+
+		missing = append([]string{dir}, missing...)
+
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	return missing
+}
+
+func (t osTargetFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !t.fsync {
+		return os.WriteFile(name, data, perm)
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(name))
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+func (osTargetFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osTargetFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func isOSTargetFS(t TargetFS) bool {
+	_, ok := t.(osTargetFS)
+	return ok
+}
+
+// MemoryTargetFS is a TargetFS that keeps all files in memory
+type MemoryTargetFS struct {
+	files map[string]*memoryFile
+	mu    sync.Mutex
+}
+
+type memoryFile struct {
+	name    string
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (f *memoryFile) Name() string       { return filepath.Base(f.name) }
+func (f *memoryFile) Size() int64        { return int64(len(f.data)) }
+func (f *memoryFile) Mode() fs.FileMode  { return f.mode }
+func (f *memoryFile) ModTime() time.Time { return f.modTime }
+func (f *memoryFile) IsDir() bool        { return f.mode.IsDir() }
+func (f *memoryFile) Sys() any           { return nil }
+
+// NewMemoryTargetFS creates a new empty in-memory target filesystem
+func NewMemoryTargetFS() *MemoryTargetFS {
+	return &MemoryTargetFS{files: make(map[string]*memoryFile)}
+}
+
+// MkdirAll implements TargetFS
+func (m *MemoryTargetFS) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.mkdirAll(filepath.Clean(path), perm)
+}
+
+func (m *MemoryTargetFS) mkdirAll(path string, perm fs.FileMode) error {
+	if f, ok := m.files[path]; ok {
+		if !f.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: path, Err: fmt.Errorf("not a directory")}
+		}
+
+		return nil
+	}
+
+	parent := filepath.Dir(path)
+	if parent != path {
+		err := m.mkdirAll(parent, perm)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.files[path] = &memoryFile{name: path, mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+
+	return nil
+}
+
+// WriteFile implements TargetFS, the parent directory must exist
+func (m *MemoryTargetFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+
+	parent, ok := m.files[filepath.Dir(name)]
+	if !ok || !parent.IsDir() {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if f, ok := m.files[name]; ok && f.IsDir() {
+		return &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+
+	content := make([]byte, len(data))
+	copy(content, data)
+
+	m.files[name] = &memoryFile{name: name, data: content, mode: perm.Perm(), modTime: time.Now()}
+
+	return nil
+}
+
+// Stat implements TargetFS
+func (m *MemoryTargetFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return f, nil
+}
+
+// ReadFile implements TargetFS
+func (m *MemoryTargetFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[filepath.Clean(name)]
+	if !ok || f.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	content := make([]byte, len(f.data))
+	copy(content, f.data)
+
+	return content, nil
+}
+
+// Files lists the names of all regular files held in the filesystem, sorted
+func (m *MemoryTargetFS) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var res []string
+	for k, f := range m.files {
+		if !f.IsDir() {
+			res = append(res, k)
+		}
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+// paths lists the names of all files and directories held in the filesystem, sorted
+func (m *MemoryTargetFS) paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make([]string, 0, len(m.files))
+	for k := range m.files {
+		res = append(res, k)
+	}
+
+	sort.Strings(res)
+
+	return res
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2023-2024, R.I. Pienaar and the Choria Project contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package scaffold
+
+import (
+	"fmt"
+	"reflect"
+	"text/template"
+	"text/template/parse"
+	"unicode/utf8"
+)
+
+// maxTraceArgument is the longest argument value kept in a trace
+const maxTraceArgument = 80
+
+// TraceEntry is a template function called while rendering a file
+type TraceEntry struct {
+	// Function is the name of the function
+	Function string `json:"function"`
+	// Arguments are the arguments passed to the function, long values are truncated and sensitive values redacted
+	Arguments []string `json:"arguments,omitempty"`
+	// Error is the error returned by the function
+	Error string `json:"error,omitempty"`
+}
+
+// tracePartials records the partials templ includes, in the order they appear, as template entries
+func (s *Scaffold) tracePartials(templ *template.Template) {
+	if s.trace == nil || templ.Tree == nil {
+		return
+	}
+
+	seen := map[string]bool{}
+
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+
+		case *parse.IfNode:
+			walk(n.List)
+			walk(n.ElseList)
+
+		case *parse.RangeNode:
+			walk(n.List)
+			walk(n.ElseList)
+
+		case *parse.WithNode:
+			walk(n.List)
+			walk(n.ElseList)
+
+		case *parse.TemplateNode:
+			*s.trace = append(*s.trace, TraceEntry{Function: "template", Arguments: []string{n.Name}})
+
+			if seen[n.Name] {
+				return
+			}
+			seen[n.Name] = true
+
+			if t := templ.Lookup(n.Name); t != nil && t.Tree != nil {
+				walk(t.Tree.Root)
+			}
+		}
+	}
+
+	walk(templ.Tree.Root)
+}
+
+// traceFuncs wraps every function in funcs to record its calls in the trace of the file being rendered
+func (s *Scaffold) traceFuncs(funcs template.FuncMap) {
+	for name, fn := range funcs {
+		funcs[name] = s.traceFunc(name, fn)
+	}
+}
+
+func (s *Scaffold) traceFunc(name string, fn any) any {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func {
+		return fn
+	}
+
+	ft := fv.Type()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+
+	return reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+		var res []reflect.Value
+		if ft.IsVariadic() {
+			res = fv.CallSlice(args)
+		} else {
+			res = fv.Call(args)
+		}
+
+		if s.trace == nil {
+			return res
+		}
+
+		entry := TraceEntry{Function: name}
+		for i, a := range args {
+			if ft.IsVariadic() && i == len(args)-1 {
+				for j := 0; j < a.Len(); j++ {
+					entry.Arguments = append(entry.Arguments, s.traceArgument(a.Index(j)))
+				}
+				continue
+			}
+			entry.Arguments = append(entry.Arguments, s.traceArgument(a))
+		}
+
+		if n := ft.NumOut(); n > 0 && ft.Out(n-1) == errorType && !res[n-1].IsNil() {
+			entry.Error = s.redact(res[n-1].Interface().(error).Error())
+		}
+
+		*s.trace = append(*s.trace, entry)
+
+		return res
+	}).Interface()
+}
+
+func (s *Scaffold) traceArgument(v reflect.Value) string {
+	var arg string
+	if v.IsValid() && v.CanInterface() {
+		arg = fmt.Sprintf("%v", v.Interface())
+	} else {
+		arg = "<nil>"
+	}
+
+	arg = s.redact(arg)
+	if len(arg) > maxTraceArgument {
+		end := maxTraceArgument
+		for end > 0 && !utf8.RuneStart(arg[end]) {
+			end--
+		}
+		arg = arg[:end] + "..."
+	}
+
+	return arg
+}